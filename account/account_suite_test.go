@@ -1,11 +1,19 @@
 package account_test
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"path"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	. "github.com/wpe_merge/wpe_merge/account"
 
@@ -18,6 +26,9 @@ import (
 
 var emulator *WPEmulator
 
+// defaultPageSize is the page size the emulator uses when none is asked for
+const defaultPageSize = 100
+
 func TestAccount(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "Account Suite")
@@ -37,15 +48,39 @@ type WPEmulator struct {
 	svr    *httptest.Server
 	router *mux.Router
 	data   map[string]*Account
+
+	// noBulk hides the bulk endpoint, like an older server would
+	noBulk bool
+	// broken accounts fail with a 500 when they are looked up on their own
+	broken map[string]bool
+	// bulkRequests and accountRequests count the lookups that were tried
+	bulkRequests    int64
+	accountRequests int64
 }
 
 func NewWPEmulator() *WPEmulator {
+	wpe := newWPEmulator()
+	wpe.svr.Start()
+	return wpe
+}
+
+// NewTLSWPEmulator serves over https.  cfg can ask for client certificates,
+// limit the versions and so on; the server certificate is filled in.
+func NewTLSWPEmulator(cfg *tls.Config) *WPEmulator {
+	wpe := newWPEmulator()
+	wpe.svr.TLS = cfg
+	wpe.svr.StartTLS()
+	return wpe
+}
+
+func newWPEmulator() *WPEmulator {
 	wpe := &WPEmulator{}
 
 	router := mux.NewRouter()
 	router.HandleFunc(AccountsEndpoint, wpe.getAccounts)
+	router.HandleFunc(BulkAccountsEndpoint, wpe.getBulk).Methods("POST")
 	router.HandleFunc(path.Join(AccountsEndpoint, "{id:[0-9]+}"), wpe.getAccount)
-	svr := httptest.NewServer(router)
+	svr := httptest.NewUnstartedServer(router)
 
 	wpe.svr = svr
 	wpe.router = router
@@ -62,6 +97,11 @@ func (wpe *WPEmulator) URL() string {
 	return wpe.svr.URL
 }
 
+// Certificate is the certificate the TLS emulator serves
+func (wpe *WPEmulator) Certificate() *x509.Certificate {
+	return wpe.svr.Certificate()
+}
+
 func (wpe *WPEmulator) LoadData(data ...*Account) {
 	for i, record := range data {
 		key := fmt.Sprintf("%d", record.AccountId)
@@ -71,15 +111,99 @@ func (wpe *WPEmulator) LoadData(data ...*Account) {
 
 func (wpe *WPEmulator) ResetData() {
 	wpe.data = make(map[string]*Account)
+	wpe.noBulk = false
+	wpe.broken = nil
+	atomic.StoreInt64(&wpe.bulkRequests, 0)
+	atomic.StoreInt64(&wpe.accountRequests, 0)
+}
+
+// DisableBulk makes the bulk endpoint return a 404 until the data is reset
+func (wpe *WPEmulator) DisableBulk() {
+	wpe.noBulk = true
+}
+
+// BreakAccounts makes single lookups of the accounts fail with a 500 until the
+// data is reset
+func (wpe *WPEmulator) BreakAccounts(ids ...string) {
+	wpe.broken = make(map[string]bool, len(ids))
+	for _, id := range ids {
+		wpe.broken[id] = true
+	}
+}
+
+// Requests returns the number of bulk and single account lookups made
+func (wpe *WPEmulator) Requests() (bulk, single int64) {
+	return atomic.LoadInt64(&wpe.bulkRequests), atomic.LoadInt64(&wpe.accountRequests)
 }
 
 func (wpe *WPEmulator) getAccounts(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	var resp GetAccountsResponse
-	resp.Results = make([]*Account, 0, len(wpe.data))
+	// pages are in account id order, like the real server
+	accts := make([]*Account, 0, len(wpe.data))
 	for key := range wpe.data {
-		resp.Results = append(resp.Results, wpe.data[key])
+		accts = append(accts, wpe.data[key])
+	}
+	sort.Slice(accts, func(i, j int) bool { return accts[i].AccountId < accts[j].AccountId })
+
+	page, pageSize := 1, defaultPageSize
+	if v := r.URL.Query().Get("page"); v != "" {
+		page, _ = strconv.Atoi(v)
+	}
+	if v := r.URL.Query().Get("page_size"); v != "" {
+		pageSize, _ = strconv.Atoi(v)
+	}
+	start := (page - 1) * pageSize
+	if page < 1 || pageSize < 1 || (start >= len(accts) && page > 1) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(&ResponseError{Detail: "Invalid page."})
+		return
+	}
+	end := start + pageSize
+	if end > len(accts) {
+		end = len(accts)
+	}
+
+	pageURL := func(page int) string {
+		return fmt.Sprintf("%s%s?page=%d&page_size=%d", wpe.URL(), AccountsEndpoint, page, pageSize)
+	}
+	resp := GetAccountsResponse{Count: len(accts), Results: accts[start:end]}
+	if end < len(accts) {
+		resp.Next = pageURL(page + 1)
+	}
+	if page > 1 {
+		resp.Previous = pageURL(page - 1)
+	}
+	enc := json.NewEncoder(w)
+	err := enc.Encode(&resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (wpe *WPEmulator) getBulk(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt64(&wpe.bulkRequests, 1)
+	if wpe.noBulk {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	var req struct {
+		AccountIds []string `json:"account_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ResponseError{Detail: err.Error()})
+		return
+	}
+
+	var resp GetAccountsResponse
+	resp.Results = make([]*Account, 0, len(req.AccountIds))
+	for _, id := range req.AccountIds {
+		if account, ok := wpe.data[id]; ok {
+			resp.Results = append(resp.Results, account)
+		}
 	}
 	enc := json.NewEncoder(w)
 	err := enc.Encode(&resp)
@@ -89,9 +213,15 @@ func (wpe *WPEmulator) getAccounts(w http.ResponseWriter, r *http.Request) {
 }
 
 func (wpe *WPEmulator) getAccount(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt64(&wpe.accountRequests, 1)
 	w.Header().Set("Content-Type", "application/json")
 
 	accountID := mux.Vars(r)["id"]
+	if wpe.broken[accountID] {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(ResponseError{Detail: "Server Error"})
+		return
+	}
 	account, ok := wpe.data[accountID]
 	if !ok {
 		w.WriteHeader(http.StatusNotFound)
@@ -108,3 +238,89 @@ func (wpe *WPEmulator) getAccount(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
+
+// stubClient finds every account straight away, so that the streamer itself
+// is the only thing being measured
+type stubClient struct{}
+
+func (stubClient) GetAccounts(ctx context.Context, req *GetAccountsRequest) (*GetAccountsResponse, error) {
+	return &GetAccountsResponse{}, nil
+}
+
+func (stubClient) GetAccount(ctx context.Context, req *GetAccountRequest) (*Account, error) {
+	id, _ := strconv.Atoi(req.AccountId)
+	return &Account{AccountId: id, Status: "good", CreatedOn: "2019-12-12"}, nil
+}
+
+func (c stubClient) GetAccountsByIDs(ctx context.Context, ids []string) (*GetAccountsResponse, error) {
+	resp := &GetAccountsResponse{}
+	for _, id := range ids {
+		acct, _ := c.GetAccount(ctx, &GetAccountRequest{AccountId: id})
+		resp.Results = append(resp.Results, acct)
+	}
+	return resp, nil
+}
+
+// fakeClient is a stubClient whose calls can be slowed down or made to fail.
+// behave is given the number of the call, counting from 1, and how many calls
+// are in flight, including this one, and decides how long the call takes and
+// what it fails with.  Calls wait for the gate to close first if there is one.
+type fakeClient struct {
+	stubClient
+	behave func(call int64, inflight int) (time.Duration, error)
+	gate   chan struct{}
+
+	mu             sync.Mutex
+	calls          int64
+	inflight, peak int
+}
+
+func (c *fakeClient) GetAccount(ctx context.Context, req *GetAccountRequest) (*Account, error) {
+	c.mu.Lock()
+	c.calls++
+	c.inflight++
+	if c.inflight > c.peak {
+		c.peak = c.inflight
+	}
+	var (
+		delay time.Duration
+		err   error
+	)
+	if c.behave != nil {
+		delay, err = c.behave(c.calls, c.inflight)
+	}
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		c.inflight--
+		c.mu.Unlock()
+	}()
+
+	if c.gate != nil {
+		<-c.gate
+	}
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c.stubClient.GetAccount(ctx, req)
+}
+
+// Calls returns the number of calls so far
+func (c *fakeClient) Calls() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls
+}
+
+// Peak returns the most calls that were in flight at once
+func (c *fakeClient) Peak() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.peak
+}
@@ -0,0 +1,131 @@
+package account
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// WithBatchSize returns a WPStreamerOption that looks rows up n at a time with
+// GetAccountsByIDs, rather than making a request for every row.  Each batch
+// counts as one of the concurrent requests.
+func WithBatchSize(n int) WPStreamerOption {
+	if n <= 0 {
+		panic("batch size must be greater than 0")
+	}
+	return func(s *WPStreamer) {
+		s.batchSize = n
+	}
+}
+
+// lookupRow is a row waiting to be looked up
+type lookupRow struct {
+	inRecord  InRecord
+	accountId string
+	index     int64
+}
+
+// batch collects rows until there are enough to look up together.  Every
+// reader has its own.
+type batch struct {
+	p    *pass
+	rows []lookupRow
+}
+
+func (p *pass) newBatch() *batch {
+	return &batch{p: p}
+}
+
+// add queues the row, looking up the batch once it is full
+func (b *batch) add(row lookupRow) error {
+	b.rows = append(b.rows, row)
+	if len(b.rows) < b.p.s.batchSize {
+		return nil
+	}
+	return b.flush()
+}
+
+// flush looks up the rows in the batch in the background
+func (b *batch) flush() error {
+	if len(b.rows) == 0 {
+		return nil
+	}
+	p, s := b.p, b.p.s
+	rows := b.rows
+	b.rows = nil
+
+	// Acquire a resource that will permit the creation of a http request.
+	// We use a limiter here in order to throttle the number of concurrent
+	// requests made to the server.  Since the reader waits here,
+	// it is also what keeps the number of rows in flight bounded: if the
+	// server or the writer falls behind, we stop reading until it catches up.
+	if err := s.limit.acquire(p.gctx); err != nil {
+		return errors.Wrap(err, "could not process data")
+	}
+
+	p.g.Go(func() error {
+		// The slot is held until the rows are written, to keep the
+		// backpressure, but the limiter only hears how the lookup went
+		var (
+			start     = time.Now()
+			elapsed   time.Duration
+			lookupErr error
+		)
+		defer func() {
+			s.limit.release(elapsed, lookupErr)
+		}()
+
+		if s.batchSize == 1 {
+			// Get the account from the server
+			resp, err := s.lookup(p.gctx, rows[0].accountId)
+			elapsed, lookupErr = time.Since(start), err
+			return p.finishRow(rows[0], resp, err)
+		}
+		resp, err := s.client.GetAccountsByIDs(p.gctx, batchIds(rows))
+		elapsed, lookupErr = time.Since(start), err
+		return p.finishBatch(rows, resp, err)
+	})
+	return nil
+}
+
+// batchIds returns the distinct account ids in the batch
+func batchIds(rows []lookupRow) []string {
+	var (
+		ids  []string
+		seen = make(map[string]bool, len(rows))
+	)
+	for _, row := range rows {
+		if !seen[row.accountId] {
+			seen[row.accountId] = true
+			ids = append(ids, row.accountId)
+		}
+	}
+	return ids
+}
+
+// finishBatch matches the rows up with the accounts from a single call.  If the
+// call failed, every row in the batch fails with it, otherwise only the rows
+// whose lookup failed on its own do.
+func (p *pass) finishBatch(rows []lookupRow, resp *GetAccountsResponse, err error) error {
+	found := make(map[string]*Account, len(rows))
+	if err == nil {
+		for _, acct := range resp.Results {
+			found[strconv.Itoa(acct.AccountId)] = acct
+		}
+	}
+
+	for _, row := range rows {
+		acct, rowErr := found[row.accountId], err
+		if rowErr == nil && resp.Errors[row.accountId] != nil {
+			rowErr = resp.Errors[row.accountId]
+		}
+		if rowErr == nil && acct == nil {
+			rowErr = errors.Wrap(ErrAccountNotFound, "could not look up account")
+		}
+		if err := p.finishRow(row, acct, rowErr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
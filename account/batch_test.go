@@ -0,0 +1,144 @@
+package account_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	. "github.com/wpe_merge/wpe_merge/account"
+	"github.com/wpe_merge/wpe_merge/account/mocks"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Batch lookups", func() {
+	var (
+		T = GinkgoT()
+
+		ctx    context.Context
+		cancel context.CancelFunc
+		client *mocks.Client
+
+		mockCtx = mock.AnythingOfType("*context.cancelCtx")
+	)
+
+	BeforeEach(func() {
+		client = &mocks.Client{}
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+		client.AssertExpectations(T)
+	})
+
+	getReader := func() io.Reader {
+		var buf bytes.Buffer
+		Ω(csv.NewWriter(&buf).WriteAll([][]string{
+			{"Account ID", "Account Name", "First Name", "Created On"},
+			{"1", "jdoe", "Jane", "2020-01-01"},
+			{"2", "bdole", "Bob", "2020-02-02"},
+			{"01", "jdoe", "Janet", "2020-03-03"},
+			{"4", "gknight", "Gladys", "2020-04-04"},
+			{"5", "pmoss", "Pat", "2020-05-05"},
+		})).Should(Succeed())
+		return &buf
+	}
+
+	readRows := func(w *bytes.Buffer) [][]string {
+		records, err := csv.NewReader(w).ReadAll()
+		Ω(err).ShouldNot(HaveOccurred())
+		return records[1:]
+	}
+
+	It("should look up the rows in batches", func() {
+		client.On("GetAccountsByIDs", mockCtx, []string{"1", "2"}).
+			Return(&GetAccountsResponse{Results: []*Account{
+				{AccountId: 1, Status: "good", CreatedOn: "2019-12-12"},
+				{AccountId: 2, Status: "great", CreatedOn: "2019-11-11"},
+			}}, nil).Once()
+		client.On("GetAccountsByIDs", mockCtx, []string{"1", "4"}).
+			Return(&GetAccountsResponse{Results: []*Account{
+				{AccountId: 1, Status: "good", CreatedOn: "2019-12-12"},
+			}}, nil).Once()
+		client.On("GetAccountsByIDs", mockCtx, []string{"5"}).
+			Return(&GetAccountsResponse{Results: []*Account{
+				{AccountId: 5, Status: "grape", CreatedOn: "2019-10-10"},
+			}}, nil).Once()
+
+		var w bytes.Buffer
+		streamer := NewWPStreamer(client, WithBatchSize(2))
+		sum, err := streamer.Run(ctx, getReader(), &w)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(*sum).Should(Equal(Summary{Rows: 5, Duplicates: 1, Failed: 1, Written: 5}))
+
+		Ω(readRows(&w)).Should(ConsistOf(
+			[]string{"1", "Jane", "2020-01-01", "good", "2019-12-12"},
+			[]string{"2", "Bob", "2020-02-02", "great", "2019-11-11"},
+			[]string{"01", "Janet", "2020-03-03", "good", "2019-12-12"},
+			// left out of the response, so it wasn't found
+			[]string{"4", "Gladys", "2020-04-04", "", ""},
+			[]string{"5", "Pat", "2020-05-05", "grape", "2019-10-10"},
+		))
+	})
+
+	It("should fail every row in the batch if the lookup fails", func() {
+		client.On("GetAccountsByIDs", mockCtx, mock.Anything).
+			Return(nil, errors.New("error"))
+
+		var w bytes.Buffer
+		streamer := NewWPStreamer(client, WithBatchSize(10))
+		sum, err := streamer.Run(ctx, getReader(), &w)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(sum.Failed).Should(BeEquivalentTo(5))
+		client.AssertNumberOfCalls(T, "GetAccountsByIDs", 1)
+	})
+
+	It("should look up the rows in batches against the emulator", func() {
+		defer emulator.ResetData()
+		emulator.LoadData(
+			&Account{AccountId: 1, Status: "good", CreatedOn: "2019-12-12"},
+			&Account{AccountId: 5, Status: "grape", CreatedOn: "2019-10-10"},
+		)
+
+		var w bytes.Buffer
+		streamer := NewWPStreamer(NewWPClient(emulator.URL()), WithBatchSize(3))
+		sum, err := streamer.Run(ctx, getReader(), &w)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(sum.Failed).Should(BeEquivalentTo(2))
+		Ω(readRows(&w)).Should(HaveLen(5))
+
+		bulk, single := emulator.Requests()
+		Ω(bulk).Should(BeEquivalentTo(2))
+		Ω(single).Should(BeZero())
+	})
+
+	It("should only fail the rows whose lookup failed without a bulk endpoint", func() {
+		defer emulator.ResetData()
+		emulator.LoadData(
+			&Account{AccountId: 1, Status: "good", CreatedOn: "2019-12-12"},
+			&Account{AccountId: 2, Status: "great", CreatedOn: "2019-11-11"},
+			&Account{AccountId: 5, Status: "grape", CreatedOn: "2019-10-10"},
+		)
+		emulator.DisableBulk()
+		emulator.BreakAccounts("2")
+
+		var w bytes.Buffer
+		streamer := NewWPStreamer(NewWPClient(emulator.URL()), WithBatchSize(5))
+		sum, err := streamer.Run(ctx, getReader(), &w)
+		Ω(err).ShouldNot(HaveOccurred())
+		// 2 had a server error and 4 doesn't exist
+		Ω(sum.Failed).Should(BeEquivalentTo(2))
+		Ω(readRows(&w)).Should(ConsistOf(
+			[]string{"1", "Jane", "2020-01-01", "good", "2019-12-12"},
+			[]string{"2", "Bob", "2020-02-02", "", ""},
+			[]string{"01", "Janet", "2020-03-03", "good", "2019-12-12"},
+			[]string{"4", "Gladys", "2020-04-04", "", ""},
+			[]string{"5", "Pat", "2020-05-05", "grape", "2019-10-10"},
+		))
+	})
+})
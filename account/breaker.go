@@ -0,0 +1,280 @@
+package account
+
+import (
+	"context"
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrCircuitOpen is returned instead of calling the server while the circuit
+// breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// breakerMetrics is published under account_breaker in expvar.  All breakers
+// share it.
+var breakerMetrics = expvar.NewMap("account_breaker")
+
+// BreakerState is the state of a circuit breaker
+type BreakerState int32
+
+const (
+	// BreakerClosed lets every call through and counts the failures
+	BreakerClosed BreakerState = iota
+	// BreakerOpen fails every call without calling the server
+	BreakerOpen
+	// BreakerHalfOpen lets a single call through to see if the server has
+	// recovered
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// BreakerOption is an option that can be passed into the BreakerClient
+type BreakerOption func(b *BreakerClient)
+
+// WithFailureRatio returns a BreakerOption that opens the breaker once at least
+// this share of the calls in a window fail
+func WithFailureRatio(ratio float64) BreakerOption {
+	if ratio <= 0 || ratio > 1 {
+		panic("failure ratio must be greater than 0 and at most 1")
+	}
+	return func(b *BreakerClient) {
+		b.ratio = ratio
+	}
+}
+
+// WithMinRequests returns a BreakerOption that keeps the breaker closed until a
+// window has seen at least n calls, so a couple of early failures don't trip it
+func WithMinRequests(n int64) BreakerOption {
+	if n <= 0 {
+		panic("min requests must be greater than 0")
+	}
+	return func(b *BreakerClient) {
+		b.minRequests = n
+	}
+}
+
+// WithCoolDown returns a BreakerOption that sets how long the breaker stays
+// open before letting a call through to try the server again
+func WithCoolDown(d time.Duration) BreakerOption {
+	return func(b *BreakerClient) {
+		b.coolDown = d
+	}
+}
+
+// WithBreakerWindow returns a BreakerOption that sets how often the counts are
+// reset while the breaker is closed, so old failures are forgotten
+func WithBreakerWindow(d time.Duration) BreakerOption {
+	return func(b *BreakerClient) {
+		b.window = d
+	}
+}
+
+// BreakerClient is a Client that stops calling the server once too many calls
+// fail, so that a server that is down gets a rest instead of every remaining
+// row.  Accounts that don't exist and other 4xx responses count as successes,
+// since the server answered; calls cancelled by the caller don't count at all.
+type BreakerClient struct {
+	Client
+
+	ratio       float64
+	minRequests int64
+	coolDown    time.Duration
+	window      time.Duration
+
+	mu    sync.Mutex
+	state BreakerState
+	// generation changes with the state, so calls that started under an
+	// earlier state don't count towards the current one
+	generation         int64
+	requests, failures int64
+	// expires is the end of the window while closed and the end of the cool
+	// down while open
+	expires time.Time
+	probing bool
+}
+
+var _ Client = &BreakerClient{}
+
+// NewBreakerClient wraps a client with a circuit breaker
+func NewBreakerClient(client Client, ops ...BreakerOption) *BreakerClient {
+	b := &BreakerClient{
+		Client:      client,
+		ratio:       0.5,
+		minRequests: 20,
+		coolDown:    30 * time.Second,
+		window:      time.Minute,
+	}
+	for _, op := range ops {
+		op(b)
+	}
+	b.expires = time.Now().Add(b.window)
+	BreakerClosed.publish()
+	return b
+}
+
+// State returns the current state of the breaker
+func (b *BreakerClient) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// an open breaker whose cool down is over is as good as half-open
+	if b.state == BreakerOpen && !time.Now().Before(b.expires) {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+func (b *BreakerClient) GetAccount(ctx context.Context, req *GetAccountRequest) (*Account, error) {
+	generation, err := b.allow()
+	if err != nil {
+		return nil, err
+	}
+	acct, err := b.Client.GetAccount(ctx, req)
+	b.done(ctx, generation, err)
+	return acct, err
+}
+
+func (b *BreakerClient) GetAccounts(ctx context.Context, req *GetAccountsRequest) (*GetAccountsResponse, error) {
+	generation, err := b.allow()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := b.Client.GetAccounts(ctx, req)
+	b.done(ctx, generation, err)
+	return resp, err
+}
+
+func (b *BreakerClient) GetAccountsByIDs(ctx context.Context, ids []string) (*GetAccountsResponse, error) {
+	generation, err := b.allow()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := b.Client.GetAccountsByIDs(ctx, ids)
+	b.done(ctx, generation, err)
+	return resp, err
+}
+
+// allow decides whether a call can go through, returning the generation it
+// belongs to
+func (b *BreakerClient) allow() (int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	switch b.state {
+	case BreakerClosed:
+		if !now.Before(b.expires) {
+			b.requests, b.failures = 0, 0
+			b.expires = now.Add(b.window)
+		}
+	case BreakerOpen:
+		if now.Before(b.expires) {
+			breakerMetrics.Add("rejected", 1)
+			return 0, ErrCircuitOpen
+		}
+		b.setState(BreakerHalfOpen)
+		fallthrough
+	case BreakerHalfOpen:
+		if b.probing {
+			breakerMetrics.Add("rejected", 1)
+			return 0, ErrCircuitOpen
+		}
+		b.probing = true
+	}
+	return b.generation, nil
+}
+
+// done records how a call went
+func (b *BreakerClient) done(ctx context.Context, generation int64, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation != b.generation {
+		return
+	}
+	if b.state == BreakerHalfOpen {
+		b.probing = false
+	}
+	if err != nil && ctx.Err() != nil {
+		// the caller gave up, which says nothing about the server
+		return
+	}
+
+	failed := isServerFailure(err)
+	breakerMetrics.Add("requests", 1)
+	if failed {
+		breakerMetrics.Add("failures", 1)
+	}
+
+	switch b.state {
+	case BreakerClosed:
+		b.requests++
+		if failed {
+			b.failures++
+		}
+		if b.requests >= b.minRequests && float64(b.failures) >= b.ratio*float64(b.requests) {
+			b.setState(BreakerOpen)
+		}
+	case BreakerHalfOpen:
+		if failed {
+			b.setState(BreakerOpen)
+		} else {
+			b.setState(BreakerClosed)
+		}
+	}
+}
+
+// setState moves to a new state and starts it afresh.  b.mu must be held.
+func (b *BreakerClient) setState(state BreakerState) {
+	log := logrus.WithField("from", b.state).WithField("to", state)
+	switch state {
+	case BreakerOpen:
+		log.WithField("failures", b.failures).WithField("requests", b.requests).
+			Warnf("Circuit breaker opened, pausing requests for %s", b.coolDown)
+		breakerMetrics.Add("trips", 1)
+		b.expires = time.Now().Add(b.coolDown)
+	case BreakerHalfOpen:
+		log.Info("Circuit breaker half-open, trying the server again")
+	case BreakerClosed:
+		log.Info("Circuit breaker closed")
+		b.expires = time.Now().Add(b.window)
+	}
+
+	state.publish()
+	b.state = state
+	b.generation++
+	b.requests, b.failures = 0, 0
+	b.probing = false
+}
+
+func (s BreakerState) publish() {
+	v := new(expvar.String)
+	v.Set(s.String())
+	breakerMetrics.Set("state", v)
+}
+
+// isServerFailure decides whether an error means the server is in trouble.
+// Errors the server answered with on purpose, like not found, don't.
+func isServerFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	if resp, ok := errors.Cause(err).(ResponseError); ok {
+		return resp.StatusCode >= 500
+	}
+	return true
+}
@@ -0,0 +1,167 @@
+package account_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/wpe_merge/wpe_merge/account"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BreakerClient", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		flaky  *fakeClient
+		// down fails the calls and missing makes them not found while set
+		down, missing int32
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		down, missing = 0, 0
+		flaky = &fakeClient{behave: func(int64, int) (time.Duration, error) {
+			if atomic.LoadInt32(&down) != 0 {
+				return 0, errors.New("connection refused")
+			}
+			if atomic.LoadInt32(&missing) != 0 {
+				return 0, ErrAccountNotFound
+			}
+			return 0, nil
+		}}
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	get := func(c Client) error {
+		_, err := c.GetAccount(ctx, &GetAccountRequest{AccountId: "1"})
+		return err
+	}
+
+	It("should open once enough calls fail", func() {
+		breaker := NewBreakerClient(flaky, WithMinRequests(4), WithFailureRatio(0.5))
+		Ω(get(breaker)).Should(Succeed())
+		Ω(get(breaker)).Should(Succeed())
+
+		atomic.StoreInt32(&down, 1)
+		Ω(get(breaker)).ShouldNot(Succeed())
+		Ω(breaker.State()).Should(Equal(BreakerClosed))
+		Ω(get(breaker)).ShouldNot(Succeed())
+		Ω(breaker.State()).Should(Equal(BreakerOpen))
+
+		// the server isn't called while the breaker is open
+		Ω(get(breaker)).Should(Equal(ErrCircuitOpen))
+		Ω(flaky.Calls()).Should(BeEquivalentTo(4))
+	})
+
+	It("should not count accounts that don't exist as failures", func() {
+		breaker := NewBreakerClient(flaky, WithMinRequests(2))
+		atomic.StoreInt32(&missing, 1)
+		for i := 0; i < 10; i++ {
+			Ω(IsNotFound(get(breaker))).Should(BeTrue())
+		}
+		Ω(breaker.State()).Should(Equal(BreakerClosed))
+	})
+
+	It("should forget failures from an earlier window", func() {
+		breaker := NewBreakerClient(flaky, WithMinRequests(2), WithBreakerWindow(20*time.Millisecond))
+		atomic.StoreInt32(&down, 1)
+		Ω(get(breaker)).ShouldNot(Succeed())
+		time.Sleep(30 * time.Millisecond)
+
+		atomic.StoreInt32(&down, 0)
+		Ω(get(breaker)).Should(Succeed())
+		Ω(breaker.State()).Should(Equal(BreakerClosed))
+	})
+
+	It("should try the server again after the cool down", func() {
+		breaker := NewBreakerClient(flaky, WithMinRequests(1), WithCoolDown(20*time.Millisecond))
+		atomic.StoreInt32(&down, 1)
+		Ω(get(breaker)).ShouldNot(Succeed())
+		Ω(breaker.State()).Should(Equal(BreakerOpen))
+
+		// a failed probe opens it again
+		time.Sleep(30 * time.Millisecond)
+		Ω(breaker.State()).Should(Equal(BreakerHalfOpen))
+		Ω(get(breaker)).ShouldNot(Equal(ErrCircuitOpen))
+		Ω(breaker.State()).Should(Equal(BreakerOpen))
+		Ω(get(breaker)).Should(Equal(ErrCircuitOpen))
+
+		// a successful one closes it
+		time.Sleep(30 * time.Millisecond)
+		atomic.StoreInt32(&down, 0)
+		Ω(get(breaker)).Should(Succeed())
+		Ω(breaker.State()).Should(Equal(BreakerClosed))
+	})
+
+	It("should only let one call through while half-open", func() {
+		breaker := NewBreakerClient(flaky, WithMinRequests(1), WithCoolDown(0))
+		atomic.StoreInt32(&down, 1)
+		Ω(get(breaker)).ShouldNot(Succeed())
+
+		// hold the probe up until the second call has been turned away
+		atomic.StoreInt32(&down, 0)
+		flaky.gate = make(chan struct{})
+		probe := make(chan error)
+		go func() {
+			probe <- get(breaker)
+		}()
+		Eventually(func() int64 { return flaky.Calls() }).Should(BeEquivalentTo(2))
+		Ω(get(breaker)).Should(Equal(ErrCircuitOpen))
+
+		close(flaky.gate)
+		Ω(<-probe).Should(Succeed())
+		Ω(breaker.State()).Should(Equal(BreakerClosed))
+	})
+
+	Describe("with the streamer", func() {
+		input := func(n int) *bytes.Buffer {
+			var buf bytes.Buffer
+			Ω(writeInput(&buf, n, 1)).Should(Succeed())
+			return &buf
+		}
+
+		It("should stop the run once the breaker opens", func() {
+			atomic.StoreInt32(&down, 1)
+			breaker := NewBreakerClient(flaky, WithMinRequests(5))
+			streamer := NewWPStreamer(breaker,
+				WithMaxConcurrentRequests(1),
+				WithFailurePolicy(FailureAbortOnOpen))
+			_, err := streamer.Run(ctx, input(1000), ioutil.Discard)
+			Ω(errors.Cause(err)).Should(Equal(ErrCircuitOpen))
+			Ω(flaky.Calls()).Should(BeEquivalentTo(5))
+		})
+
+		It("should keep going by default", func() {
+			atomic.StoreInt32(&down, 1)
+			breaker := NewBreakerClient(flaky, WithMinRequests(5))
+			sum, err := NewWPStreamer(breaker).Run(ctx, input(100), ioutil.Discard)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(sum.Failed).Should(BeEquivalentTo(100))
+			Ω(sum.Written).Should(BeEquivalentTo(100))
+		})
+
+		It("should stop at the first failure if asked to", func() {
+			streamer := NewWPStreamer(flaky,
+				WithMaxConcurrentRequests(1),
+				WithFailurePolicy(FailureAbort))
+
+			atomic.StoreInt32(&missing, 1)
+			_, err := streamer.Run(ctx, input(10), ioutil.Discard)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			atomic.StoreInt32(&down, 1)
+			_, err = streamer.Run(ctx, input(10), ioutil.Discard)
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(ContainSubstring("connection refused"))
+		})
+	})
+})
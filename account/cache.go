@@ -0,0 +1,103 @@
+package account
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// CachingClient is a Client that remembers the accounts it has looked up, so
+// that an account listed in several files is only requested once.  Accounts
+// the server says don't exist are remembered too, but any other error, like a
+// 500 or a 429 or not getting through to the server at all, is not, so those
+// lookups are tried again.
+type CachingClient struct {
+	Client
+
+	mu       sync.RWMutex
+	accounts map[string]cachedAccount
+}
+
+type cachedAccount struct {
+	account *Account
+	err     error
+}
+
+var _ Client = &CachingClient{}
+
+// NewCachingClient wraps a client with a cache.  The cache is never evicted,
+// so it grows with the number of distinct account ids looked up.
+func NewCachingClient(client Client) *CachingClient {
+	return &CachingClient{
+		Client:   client,
+		accounts: make(map[string]cachedAccount),
+	}
+}
+
+// GetAccount returns the cached account, or looks it up if it hasn't been seen
+func (c *CachingClient) GetAccount(ctx context.Context, req *GetAccountRequest) (*Account, error) {
+	c.mu.RLock()
+	cached, ok := c.accounts[req.AccountId]
+	c.mu.RUnlock()
+	if ok {
+		return cached.account, cached.err
+	}
+
+	acct, err := c.Client.GetAccount(ctx, req)
+	if err == nil || IsNotFound(err) {
+		c.mu.Lock()
+		c.accounts[req.AccountId] = cachedAccount{account: acct, err: err}
+		c.mu.Unlock()
+	}
+	return acct, err
+}
+
+// GetAccountsByIDs returns the cached accounts and looks up the rest in one go.
+// Accounts left out of the response are remembered as not found.
+func (c *CachingClient) GetAccountsByIDs(ctx context.Context, ids []string) (*GetAccountsResponse, error) {
+	resp := &GetAccountsResponse{Results: make([]*Account, 0, len(ids))}
+
+	var missing []string
+	c.mu.RLock()
+	for _, id := range ids {
+		cached, ok := c.accounts[id]
+		if !ok {
+			missing = append(missing, id)
+		} else if cached.account != nil {
+			resp.Results = append(resp.Results, cached.account)
+		}
+	}
+	c.mu.RUnlock()
+	if len(missing) == 0 {
+		return resp, nil
+	}
+
+	fetched, err := c.Client.GetAccountsByIDs(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]*Account, len(fetched.Results))
+	for _, acct := range fetched.Results {
+		found[strconv.Itoa(acct.AccountId)] = acct
+	}
+
+	c.mu.Lock()
+	for _, id := range missing {
+		if _, failed := fetched.Errors[id]; failed {
+			// tried again next time, like GetAccount
+			continue
+		}
+		if acct, ok := found[normalizeAccountId(id)]; ok {
+			c.accounts[id] = cachedAccount{account: acct}
+		} else {
+			c.accounts[id] = cachedAccount{err: errors.Wrap(ErrAccountNotFound, "could not look up account")}
+		}
+	}
+	c.mu.Unlock()
+
+	resp.Results = append(resp.Results, fetched.Results...)
+	resp.Errors = fetched.Errors
+	return resp, nil
+}
@@ -0,0 +1,124 @@
+package account_test
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	. "github.com/wpe_merge/wpe_merge/account"
+	"github.com/wpe_merge/wpe_merge/account/mocks"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CachingClient", func() {
+	var (
+		T = GinkgoT()
+
+		ctx    context.Context
+		cancel context.CancelFunc
+		client *mocks.Client
+		cache  *CachingClient
+
+		mockCtx = mock.AnythingOfType("*context.cancelCtx")
+	)
+
+	BeforeEach(func() {
+		client = &mocks.Client{}
+		cache = NewCachingClient(client)
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+		client.AssertExpectations(T)
+	})
+
+	It("should only look up an account once", func() {
+		acct := &Account{AccountId: 1, Status: "good", CreatedOn: "2019-12-12"}
+		client.On("GetAccount", mockCtx, &GetAccountRequest{AccountId: "1"}).Return(acct, nil).Once()
+
+		for i := 0; i < 3; i++ {
+			resp, err := cache.GetAccount(ctx, &GetAccountRequest{AccountId: "1"})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(resp).Should(Equal(acct))
+		}
+	})
+
+	It("should remember accounts that don't exist", func() {
+		notFound := errors.Wrap(ResponseError{Detail: "Not found.", StatusCode: http.StatusNotFound}, "could not look up account")
+		client.On("GetAccount", mockCtx, &GetAccountRequest{AccountId: "2"}).Return(nil, notFound).Once()
+
+		for i := 0; i < 3; i++ {
+			resp, err := cache.GetAccount(ctx, &GetAccountRequest{AccountId: "2"})
+			Ω(err).Should(Equal(notFound))
+			Ω(resp).Should(BeNil())
+		}
+	})
+
+	It("should try again if the server couldn't be reached", func() {
+		client.On("GetAccount", mockCtx, &GetAccountRequest{AccountId: "3"}).Return(nil, errors.New("error")).Twice()
+
+		for i := 0; i < 2; i++ {
+			_, err := cache.GetAccount(ctx, &GetAccountRequest{AccountId: "3"})
+			Ω(err).Should(HaveOccurred())
+		}
+	})
+
+	It("should try again if the server had an error", func() {
+		acct := &Account{AccountId: 4, Status: "good", CreatedOn: "2019-12-12"}
+		serverErr := ResponseError{Detail: "Server Error", StatusCode: http.StatusInternalServerError}
+		client.On("GetAccount", mockCtx, &GetAccountRequest{AccountId: "4"}).Return(nil, serverErr).Once()
+		client.On("GetAccount", mockCtx, &GetAccountRequest{AccountId: "4"}).Return(acct, nil).Once()
+
+		_, err := cache.GetAccount(ctx, &GetAccountRequest{AccountId: "4"})
+		Ω(err).Should(Equal(serverErr))
+		for i := 0; i < 2; i++ {
+			resp, err := cache.GetAccount(ctx, &GetAccountRequest{AccountId: "4"})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(resp).Should(Equal(acct))
+		}
+	})
+
+	It("should only look up the accounts it hasn't seen in bulk", func() {
+		one := &Account{AccountId: 1, Status: "good", CreatedOn: "2019-12-12"}
+		two := &Account{AccountId: 2, Status: "great", CreatedOn: "2019-11-11"}
+		client.On("GetAccount", mockCtx, &GetAccountRequest{AccountId: "1"}).Return(one, nil).Once()
+		client.On("GetAccountsByIDs", mockCtx, []string{"2", "3"}).
+			Return(&GetAccountsResponse{Results: []*Account{two}}, nil).Once()
+
+		_, err := cache.GetAccount(ctx, &GetAccountRequest{AccountId: "1"})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		for i := 0; i < 2; i++ {
+			resp, err := cache.GetAccountsByIDs(ctx, []string{"1", "2", "3"})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(resp.Results).Should(ConsistOf(one, two))
+		}
+
+		// the account left out of the response is remembered as not found
+		_, err = cache.GetAccount(ctx, &GetAccountRequest{AccountId: "3"})
+		Ω(IsNotFound(err)).Should(BeTrue())
+	})
+
+	It("should try again for the accounts that failed in bulk", func() {
+		one := &Account{AccountId: 1, Status: "good", CreatedOn: "2019-12-12"}
+		serverErr := ResponseError{Detail: "Server Error", StatusCode: http.StatusInternalServerError}
+		client.On("GetAccountsByIDs", mockCtx, []string{"1", "2"}).
+			Return(&GetAccountsResponse{Results: []*Account{one}, Errors: map[string]error{"2": serverErr}}, nil).Once()
+		client.On("GetAccountsByIDs", mockCtx, []string{"2"}).
+			Return(&GetAccountsResponse{}, nil).Once()
+
+		resp, err := cache.GetAccountsByIDs(ctx, []string{"1", "2"})
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(resp.Results).Should(ConsistOf(one))
+		Ω(resp.Errors).Should(HaveKeyWithValue("2", serverErr))
+
+		resp, err = cache.GetAccountsByIDs(ctx, []string{"1", "2"})
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(resp.Results).Should(ConsistOf(one))
+		Ω(resp.Errors).Should(BeEmpty())
+	})
+})
@@ -0,0 +1,175 @@
+package account
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNoRecording is returned by a Replayer for a request that isn't in the
+// cassette
+var ErrNoRecording = errors.New("no recording for request")
+
+// Interaction is a request and the response to it, one line of a cassette.
+// The url is only the path and query, so a cassette can be replayed against
+// any address.
+type Interaction struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	RequestBody string      `json:"request_body,omitempty"`
+	Status      int         `json:"status"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        string      `json:"body"`
+}
+
+// key is what requests are matched on
+func (i *Interaction) key() string {
+	return i.Method + " " + i.URL + "\n" + i.RequestBody
+}
+
+// WithRecording returns a WPClientOption that writes every request and response
+// to w, as a cassette that a Replayer can serve back
+func WithRecording(w io.Writer) WPClientOption {
+	return func(c *WPClient) {
+		c.config.recording = w
+	}
+}
+
+// Recorder is an http.RoundTripper that writes the requests and responses that
+// go through it to a cassette, one json object per line
+type Recorder struct {
+	rt http.RoundTripper
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewRecorder records the requests that go through rt to w.  A nil rt means
+// http.DefaultTransport.
+func NewRecorder(rt http.RoundTripper, w io.Writer) *Recorder {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return &Recorder{rt: rt, w: w}
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readBody(&req.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read request to record it")
+	}
+	resp, err := r.rt.RoundTrip(req)
+	if err != nil {
+		// there is nothing to play back for a request that didn't get a
+		// response
+		return nil, err
+	}
+	body, err := readBody(&resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read response to record it")
+	}
+
+	line, err := json.Marshal(&Interaction{
+		Method:      req.Method,
+		URL:         req.URL.RequestURI(),
+		RequestBody: string(reqBody),
+		Status:      resp.StatusCode,
+		Header:      resp.Header,
+		Body:        string(body),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "could not record response")
+	}
+
+	// each line goes out in one write so that a run that is cut short
+	// still leaves a usable cassette
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.w.Write(append(line, '\n')); err != nil {
+		return nil, errors.Wrap(err, "could not record response")
+	}
+	return resp, nil
+}
+
+// Replayer is an http.RoundTripper that answers requests from a cassette
+// without going anywhere.  Requests are matched on the method, path, query and
+// body.  If the same request was recorded more than once, the responses are
+// served in order, and the last one from then on.
+type Replayer struct {
+	mu           sync.Mutex
+	interactions map[string][]*Interaction
+}
+
+// LoadCassette reads a cassette written by a Recorder
+func LoadCassette(r io.Reader) (*Replayer, error) {
+	rp := &Replayer{interactions: make(map[string][]*Interaction)}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var i Interaction
+		if err := json.Unmarshal(scanner.Bytes(), &i); err != nil {
+			return nil, errors.Wrapf(err, "could not read cassette line %d", line)
+		}
+		rp.interactions[i.key()] = append(rp.interactions[i.key()], &i)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "could not read cassette")
+	}
+	return rp, nil
+}
+
+func (rp *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(&req.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read request")
+	}
+	key := (&Interaction{Method: req.Method, URL: req.URL.RequestURI(), RequestBody: string(body)}).key()
+
+	rp.mu.Lock()
+	queue := rp.interactions[key]
+	if len(queue) == 0 {
+		rp.mu.Unlock()
+		return nil, errors.Wrapf(ErrNoRecording, "%s %s", req.Method, req.URL.RequestURI())
+	}
+	i := queue[0]
+	if len(queue) > 1 {
+		rp.interactions[key] = queue[1:]
+	}
+	rp.mu.Unlock()
+
+	return &http.Response{
+		Status:        http.StatusText(i.Status),
+		StatusCode:    i.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        i.Header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader([]byte(i.Body))),
+		ContentLength: int64(len(i.Body)),
+		Request:       req,
+	}, nil
+}
+
+// readBody reads a request or response body and puts back a copy, so it can
+// still be read
+func readBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+	data, err := ioutil.ReadAll(*body)
+	(*body).Close()
+	if err != nil {
+		return nil, err
+	}
+	*body = ioutil.NopCloser(bytes.NewReader(data))
+	return data, nil
+}
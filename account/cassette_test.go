@@ -0,0 +1,108 @@
+package account_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	. "github.com/wpe_merge/wpe_merge/account"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cassettes", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+
+		cassette bytes.Buffer
+		input    string
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		cassette.Reset()
+		emulator.LoadData(
+			&Account{AccountId: 1, Status: "good", CreatedOn: "2011-01-01"},
+			&Account{AccountId: 2, Status: "bad", CreatedOn: "2012-02-02"},
+		)
+		input = "Account ID,Account Name,First Name,Created On\n" +
+			"1,jdoe,John,1/1/11\n" +
+			"2,bdole,Bob,2/2/12\n" +
+			"3,missing,Max,3/3/13\n"
+	})
+
+	AfterEach(func() {
+		cancel()
+		emulator.ResetData()
+	})
+
+	// replayer loads what was recorded so far
+	replayer := func() *Replayer {
+		rp, err := LoadCassette(bytes.NewReader(cassette.Bytes()))
+		Ω(err).ShouldNot(HaveOccurred())
+		return rp
+	}
+
+	// run streams the input with a client that makes one request at a time,
+	// so that runs write the rows in the same order
+	run := func(client Client, ops ...WPStreamerOption) string {
+		var w bytes.Buffer
+		ops = append(ops, WithMaxConcurrentRequests(1))
+		err := NewWPStreamer(client, ops...).Stream(ctx, strings.NewReader(input), &w)
+		Ω(err).ShouldNot(HaveOccurred())
+		return w.String()
+	}
+
+	It("should replay a run without the server", func() {
+		recorded := run(NewWPClient(emulator.URL(), WithRecording(&cassette)))
+		bulk, single := emulator.Requests()
+
+		replayed := run(NewWPClient("http://wpengine.invalid/", WithRoundTripper(replayer())))
+		Ω(replayed).Should(Equal(recorded))
+
+		// the server wasn't called again
+		bulkAfter, singleAfter := emulator.Requests()
+		Ω(bulkAfter).Should(Equal(bulk))
+		Ω(singleAfter).Should(Equal(single))
+	})
+
+	It("should replay bulk lookups", func() {
+		recorded := run(NewWPClient(emulator.URL(), WithRecording(&cassette)), WithBatchSize(10))
+		replayed := run(NewWPClient("http://wpengine.invalid/", WithRoundTripper(replayer())), WithBatchSize(10))
+		Ω(replayed).Should(Equal(recorded))
+	})
+
+	It("should fail requests that weren't recorded", func() {
+		client := NewWPClient(emulator.URL(), WithRecording(&cassette))
+		_, err := client.GetAccount(ctx, &GetAccountRequest{AccountId: "1"})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		client = NewWPClient(emulator.URL(), WithRoundTripper(replayer()))
+		_, err = client.GetAccount(ctx, &GetAccountRequest{AccountId: "1"})
+		Ω(err).ShouldNot(HaveOccurred())
+		_, err = client.GetAccount(ctx, &GetAccountRequest{AccountId: "2"})
+		Ω(errors.Is(err, ErrNoRecording)).Should(BeTrue())
+	})
+
+	It("should serve repeated requests in order", func() {
+		cassette.WriteString(`{"method":"GET","url":"/v1/accounts/1","status":200,"body":"{\"account_id\":1,\"status\":\"good\"}"}` + "\n")
+		cassette.WriteString(`{"method":"GET","url":"/v1/accounts/1","status":200,"body":"{\"account_id\":1,\"status\":\"closed\"}"}` + "\n")
+		client := NewWPClient("http://wpengine.invalid/", WithRoundTripper(replayer()))
+
+		var statuses []string
+		for i := 0; i < 3; i++ {
+			acct, err := client.GetAccount(ctx, &GetAccountRequest{AccountId: "1"})
+			Ω(err).ShouldNot(HaveOccurred())
+			statuses = append(statuses, acct.Status)
+		}
+		Ω(statuses).Should(Equal([]string{"good", "closed", "closed"}))
+	})
+
+	It("should reject a broken cassette", func() {
+		_, err := LoadCassette(strings.NewReader("{\"method\":\"GET\"}\nnot json\n"))
+		Ω(err).Should(MatchError(ContainSubstring("line 2")))
+	})
+})
@@ -0,0 +1,174 @@
+package account
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"io"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// WithParallelRead returns a WPStreamerOption that splits the input into n
+// chunks and parses them at the same time, all feeding the same pool of
+// lookups.  It only kicks in for inputs that can seek, like files.  Line
+// breaks inside quoted fields are allowed, but finding where the chunks start
+// means scanning the whole input once before the chunks are read.  The chunks
+// are validated at the same time too, so rules that remember earlier rows,
+// like DuplicateRule, don't see them in input order.
+func WithParallelRead(n int) WPStreamerOption {
+	if n <= 0 {
+		panic("parallel reads must be greater than 0")
+	}
+	return func(s *WPStreamer) {
+		s.readers = n
+	}
+}
+
+// seekableReader is an input that can be split into chunks
+type seekableReader interface {
+	io.Reader
+	io.ReaderAt
+	io.Seeker
+}
+
+// runChunks is run for inputs that are read in parallel.  Rows from different
+// chunks finish in any order, so keep-first has to hold on to the rows like
+// keep-last does rather than skipping the duplicates up front.
+func (s *WPStreamer) runChunks(ctx context.Context, r seekableReader, w RecordWriter, sum *Summary) error {
+	start, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return errors.Wrap(err, "could not seek input")
+	}
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return errors.Wrap(err, "could not seek input")
+	}
+
+	// The header has to match inHeader exactly, so it can't have a line
+	// break in it
+	bodyStart, err := nextLine(r, start, end)
+	if err != nil {
+		return err
+	}
+	out, err := s.open(csv.NewReader(io.NewSectionReader(r, start, bodyStart-start)), w, sum)
+	if err != nil {
+		return err
+	}
+	if s.dedupe == DedupeKeepFirst {
+		out.buffer = newDedupeBuffer(DedupeKeepFirst, out.mem)
+	}
+
+	bounds, err := splitChunks(r, bodyStart, end, s.readers)
+	if err != nil {
+		return err
+	}
+
+	p := newPass(ctx, s, out, sum)
+	readers, rctx := errgroup.WithContext(p.gctx)
+	for i := 0; i+1 < len(bounds); i++ {
+		start, end := bounds[i], bounds[i+1]
+		readers.Go(func() error {
+			return p.readChunk(rctx, r, start, end)
+		})
+	}
+	if err := readers.Wait(); err != nil {
+		return p.fail(err)
+	}
+	return p.finish()
+}
+
+// readChunk processes the rows between two offsets.  The row index starts at
+// the offset of the chunk, which keeps the indexes in input order across
+// chunks since every row takes up at least one byte.
+func (p *pass) readChunk(ctx context.Context, r io.ReaderAt, start, end int64) error {
+	cr := csv.NewReader(io.NewSectionReader(r, start, end-start))
+	cr.FieldsPerRecord = 4
+	b := p.newBatch()
+
+	for index := start; ; index++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		raw, err := cr.Read()
+		if err == io.EOF {
+			return b.flush()
+		} else if err != nil {
+			return errors.Wrapf(err, "could not read row in chunk starting at byte %d", start)
+		}
+		if err := p.process(b, InRecord(raw), index); err != nil {
+			return err
+		}
+	}
+}
+
+// splitChunks divides the bytes between start and end into at most n chunks
+// that each begin at the start of a row.  It returns the offsets the chunks
+// start at, followed by end.
+//
+// A line break inside a quoted field doesn't end the row, and there's no
+// telling whether a byte is inside quotes without reading everything before
+// it, so the input is scanned from the start.  That only looks for quotes and
+// line breaks, which is much quicker than parsing it.
+func splitChunks(r io.ReaderAt, start, end int64, n int) ([]int64, error) {
+	bounds := []int64{start}
+	size := (end - start) / int64(n)
+	// the next chunk starts at the first row at or after start + k*size
+	k := int64(1)
+	quoted := false
+	buf := make([]byte, 64*1024)
+	for offset := start; offset < end && k < int64(n); {
+		if remaining := end - offset; remaining < int64(len(buf)) {
+			buf = buf[:remaining]
+		}
+		m, err := r.ReadAt(buf, offset)
+		for i, c := range buf[:m] {
+			if c == '"' {
+				// an escaped quote toggles twice, so it leaves this alone
+				quoted = !quoted
+				continue
+			}
+			row := offset + int64(i) + 1
+			if c != '\n' || quoted || row < start+k*size || row >= end {
+				continue
+			}
+			bounds = append(bounds, row)
+			for k < int64(n) && start+k*size <= row {
+				k++
+			}
+			if k >= int64(n) {
+				break
+			}
+		}
+		offset += int64(m)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Wrap(err, "could not split input")
+		}
+	}
+	return append(bounds, end), nil
+}
+
+// nextLine returns the offset just after the first line break at or after
+// offset, or end if there isn't one
+func nextLine(r io.ReaderAt, offset, end int64) (int64, error) {
+	buf := make([]byte, 4096)
+	for offset < end {
+		if remaining := end - offset; remaining < int64(len(buf)) {
+			buf = buf[:remaining]
+		}
+		n, err := r.ReadAt(buf, offset)
+		if i := bytes.IndexByte(buf[:n], '\n'); i >= 0 {
+			return offset + int64(i) + 1, nil
+		}
+		offset += int64(n)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, errors.Wrap(err, "could not split input")
+		}
+	}
+	return end, nil
+}
@@ -0,0 +1,220 @@
+package account_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+
+	. "github.com/wpe_merge/wpe_merge/account"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// writeInput writes a csv input with n rows, where every account id shows up
+// dupes times
+func writeInput(w io.Writer, n, dupes int) error {
+	bw := bufio.NewWriter(w)
+	cw := csv.NewWriter(bw)
+	cw.Write([]string{"Account ID", "Account Name", "First Name", "Created On"})
+	for i := 0; i < n; i++ {
+		id := strconv.Itoa(i/dupes + 1)
+		cw.Write([]string{id, "user" + id, fmt.Sprintf("Name %d", i), "2020-01-01"})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+var _ = Describe("Parallel read", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	getInput := func(n, dupes int) *bytes.Reader {
+		var buf bytes.Buffer
+		Ω(writeInput(&buf, n, dupes)).Should(Succeed())
+		return bytes.NewReader(buf.Bytes())
+	}
+
+	run := func(r io.Reader, ops ...WPStreamerOption) (*Summary, [][]string) {
+		var w bytes.Buffer
+		sum, err := NewWPStreamer(stubClient{}, ops...).Run(ctx, r, &w)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		records, err := csv.NewReader(&w).ReadAll()
+		Ω(err).ShouldNot(HaveOccurred())
+		return sum, records
+	}
+
+	It("should write the same rows as reading in one go", func() {
+		sum, expected := run(getInput(1000, 1))
+		parallelSum, actual := run(getInput(1000, 1), WithParallelRead(8))
+
+		Ω(*parallelSum).Should(Equal(*sum))
+		Ω(actual[0]).Should(Equal(expected[0]))
+		Ω(actual[1:]).Should(ConsistOf(expected[1:]))
+	})
+
+	It("should start from the current offset of the reader", func() {
+		r := getInput(100, 1)
+		var prefix bytes.Buffer
+		prefix.WriteString("ignore me\n")
+		r.WriteTo(&prefix)
+		input := bytes.NewReader(prefix.Bytes())
+		input.Seek(int64(len("ignore me\n")), io.SeekStart)
+
+		sum, _ := run(input, WithParallelRead(4))
+		Ω(sum.Written).Should(BeEquivalentTo(100))
+	})
+
+	It("should keep the first row in the input across chunks", func() {
+		sum, records := run(getInput(1000, 100), WithParallelRead(8), WithDedupePolicy(DedupeKeepFirst))
+		Ω(*sum).Should(Equal(Summary{Rows: 1000, Duplicates: 990, Written: 10}))
+		Ω(records[1:]).Should(HaveLen(10))
+		for _, record := range records[1:] {
+			id, _ := strconv.Atoi(record[0])
+			Ω(record[1]).Should(Equal(fmt.Sprintf("Name %d", (id-1)*100)))
+		}
+	})
+
+	It("should keep the last row in the input across chunks", func() {
+		sum, records := run(getInput(1000, 100), WithParallelRead(8), WithDedupePolicy(DedupeKeepLast))
+		Ω(*sum).Should(Equal(Summary{Rows: 1000, Duplicates: 990, Written: 10}))
+		Ω(records[1:]).Should(HaveLen(10))
+		for _, record := range records[1:] {
+			id, _ := strconv.Atoi(record[0])
+			Ω(record[1]).Should(Equal(fmt.Sprintf("Name %d", id*100-1)))
+		}
+	})
+
+	It("should handle more chunks than rows", func() {
+		sum, _ := run(getInput(3, 1), WithParallelRead(16))
+		Ω(sum.Written).Should(BeEquivalentTo(3))
+	})
+
+	It("should handle an input without a trailing line break", func() {
+		input := bytes.NewReader([]byte("Account ID,Account Name,First Name,Created On\n1,jdoe,Jane,2020-01-01\n2,bdole,Bob,2020-02-02"))
+		sum, _ := run(input, WithParallelRead(4))
+		Ω(sum.Written).Should(BeEquivalentTo(2))
+	})
+
+	It("should not split a row on a line break inside quotes", func() {
+		var buf bytes.Buffer
+		cw := csv.NewWriter(&buf)
+		cw.Write([]string{"Account ID", "Account Name", "First Name", "Created On"})
+		for i := 1; i <= 100; i++ {
+			id := strconv.Itoa(i)
+			cw.Write([]string{id, "user" + id, "Jane\n\"Janie\"\nDoe\n", "2020-01-01"})
+		}
+		cw.Flush()
+
+		sum, records := run(bytes.NewReader(buf.Bytes()), WithParallelRead(8))
+		Ω(*sum).Should(Equal(Summary{Rows: 100, Written: 100}))
+		for _, record := range records[1:] {
+			Ω(record[1]).Should(Equal("Jane\n\"Janie\"\nDoe\n"))
+		}
+	})
+
+	It("should return an error if the header is invalid", func() {
+		input := bytes.NewReader([]byte("Account ID,First Name\n1,Jane\n"))
+		err := NewWPStreamer(stubClient{}, WithParallelRead(4)).Stream(ctx, input, ioutil.Discard)
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(HavePrefix("could not read header"))
+	})
+
+	It("should return an error if a row can't be parsed", func() {
+		input := bytes.NewReader([]byte("Account ID,Account Name,First Name,Created On\n1,jdoe,Jane,2020-01-01\n2,bdole\n"))
+		err := NewWPStreamer(stubClient{}, WithParallelRead(4)).Stream(ctx, input, ioutil.Discard)
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(ContainSubstring("could not read row"))
+	})
+})
+
+// benchRows is the size of the input used by the benchmarks
+const benchRows = 2000000
+
+var (
+	benchOnce  sync.Once
+	benchInput string
+	benchErr   error
+)
+
+// getBenchInput writes the benchmark input to a temp file the first time it is
+// needed
+func getBenchInput(b *testing.B) string {
+	benchOnce.Do(func() {
+		f, err := ioutil.TempFile("", "bench-*.csv")
+		if err != nil {
+			benchErr = err
+			return
+		}
+		defer f.Close()
+		benchInput = f.Name()
+		benchErr = writeInput(f, benchRows, 1)
+	})
+	if benchErr != nil {
+		b.Fatal(benchErr)
+	}
+	return benchInput
+}
+
+func benchmarkRun(b *testing.B, ops ...WPStreamerOption) {
+	path := getBenchInput(b)
+	info, err := os.Stat(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(info.Size())
+
+	ops = append([]WPStreamerOption{WithMaxConcurrentRequests(64)}, ops...)
+	streamer := NewWPStreamer(stubClient{}, ops...)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f, err := os.Open(path)
+		if err != nil {
+			b.Fatal(err)
+		}
+		_, err = streamer.Run(context.Background(), f, ioutil.Discard)
+		f.Close()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRun(b *testing.B) {
+	benchmarkRun(b)
+}
+
+func BenchmarkRunParallelRead2(b *testing.B) {
+	benchmarkRun(b, WithParallelRead(2))
+}
+
+func BenchmarkRunParallelRead4(b *testing.B) {
+	benchmarkRun(b, WithParallelRead(4))
+}
+
+func BenchmarkRunParallelRead8(b *testing.B) {
+	benchmarkRun(b, WithParallelRead(8))
+}
@@ -1,35 +1,69 @@
 package account
 
-import "context"
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
 
 // ResponseError provides details about a bad record
 type ResponseError struct {
 	Detail string
+
+	// StatusCode is the http status the server sent with the error
+	StatusCode int `json:"-"`
 }
 
 func (err ResponseError) Error() string {
 	return err.Detail
 }
 
+// ErrAccountNotFound is the error for an account that was left out of a
+// GetAccountsByIDs response
+var ErrAccountNotFound = ResponseError{Detail: "Not found.", StatusCode: http.StatusNotFound}
+
+// IsNotFound returns true if the error is the server saying the account doesn't
+// exist, as opposed to a problem getting an answer out of it
+func IsNotFound(err error) bool {
+	respErr, ok := errors.Cause(err).(ResponseError)
+	return ok && respErr.StatusCode == http.StatusNotFound
+}
+
 // Account represents an individual account
 type Account struct {
 	AccountId int    `json:"account_id"`
 	Status    string `json:"status"`
 	CreatedOn string `json:"created_on"`
+
+	// Extra holds any other fields the server sent back, keyed by their json
+	// name
+	Extra map[string]json.RawMessage `json:"-"`
 }
 
-// GetAccountsRequest is the request object to get all the account data.  This
-// object is empty for now, but can be expanded to handle additional input, like
-// to provide page info
+// GetAccountsRequest is the request object to get a page of the account data.
+// The zero value gets the first page at the server's page size.
 type GetAccountsRequest struct {
+	// Page is the page to get, starting from 1
+	Page int
+	// PageSize is the number of accounts on a page
+	PageSize int
 }
 
-// GetAccountsResponse is the response object for all account data.  The
-// response object has fields for "next" and "previous", but since I can't glean
-// the shape of the data, nor is that info relevant for the scope of this task,
-// I will leave it off for now.
+// GetAccountsResponse is the response object for a page of account data.  Next
+// and Previous are the urls of the pages around this one, and are empty at
+// either end.  A server that doesn't paginate sends everything in one page.
 type GetAccountsResponse struct {
-	Results []*Account
+	Count    int        `json:"count"`
+	Next     string     `json:"next"`
+	Previous string     `json:"previous"`
+	Results  []*Account `json:"results"`
+
+	// Errors holds the lookups that failed by account id, when
+	// GetAccountsByIDs had to look the accounts up one at a time.  Those ids
+	// are left out of Results, but aren't missing.
+	Errors map[string]error `json:"-"`
 }
 
 // GetAccountRequest is the request object to retrieve a single account
@@ -41,8 +75,11 @@ type GetAccountRequest struct {
 // facilitate unit testing and could make it easier to add additional layers for
 // things like caching
 type Client interface {
-	// GetAccounts retrieves all accounts on the server
+	// GetAccounts retrieves a page of the accounts on the server
 	GetAccounts(context.Context, *GetAccountsRequest) (*GetAccountsResponse, error)
 	// GetAccount retrieves a single account
 	GetAccount(context.Context, *GetAccountRequest) (*Account, error)
+	// GetAccountsByIDs retrieves several accounts at once.  Accounts that
+	// don't exist are left out of the response.
+	GetAccountsByIDs(context.Context, []string) (*GetAccountsResponse, error)
 }
@@ -0,0 +1,162 @@
+package account
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// columnFuncs are the functions available to column templates, on top of the
+// text/template builtins
+var columnFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"title": strings.Title,
+	"trim":  strings.TrimSpace,
+	"days":  daysBetween,
+	"after": func(a, b string) (bool, error) {
+		n, err := compareDates(a, b)
+		return n > 0, err
+	},
+	"before": func(a, b string) (bool, error) {
+		n, err := compareDates(a, b)
+		return n < 0, err
+	},
+	"date": func(layout, value string) (string, error) {
+		return NewDateFormatter(layout, nil).Format(value)
+	},
+}
+
+// Column is an extra output column computed from the merged record.  The
+// expression is a go template (https://golang.org/pkg/text/template/) run
+// against the Record, like
+//
+//	{{.FirstName}} ({{.AccountId}})
+//
+// An expression without any {{ }} is treated as the inside of one, so
+// `upper .FirstName` is the same as `{{upper .FirstName}}`.  On top of the
+// usual template functions, columns can use upper, lower, title, trim, days
+// (whole days from one date to another), after and before (compare two dates)
+// and date (reformat a date with a layout, e.g. `date "iso" .CreatedOn`).
+// Date functions treat a missing date as blank rather than an error, since
+// accounts that weren't found have no Status Set On.
+//
+// Like filters, columns see the dates as they were received, before they are
+// normalized.
+//
+// The value is always text, but Type tells the outputs that store more than
+// text what it holds, so `days .CreatedOn .StatusSetOn` can be an integer.
+type Column struct {
+	Name string
+	Type ColumnType
+	tmpl *template.Template
+}
+
+// ParseColumn compiles the expression for a column
+func ParseColumn(name, expr string) (*Column, error) {
+	if strings.TrimSpace(name) == "" {
+		return nil, errors.New("column name is required")
+	}
+	if !strings.Contains(expr, "{{") {
+		expr = "{{" + expr + "}}"
+	}
+	tmpl, err := template.New(name).Funcs(columnFuncs).Parse(expr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not parse column `%s`", name)
+	}
+	return &Column{Name: name, Type: TextColumn, tmpl: tmpl}, nil
+}
+
+// ParseColumnDefinition parses a column written as `name=expression`, or
+// `name:type=expression` for a column that isn't text
+func ParseColumnDefinition(def string) (*Column, error) {
+	i := strings.Index(def, "=")
+	if i < 0 {
+		return nil, errors.Errorf("column `%s` must look like name=expression", def)
+	}
+	name, typ := splitColumnType(strings.TrimSpace(def[:i]))
+	col, err := ParseColumn(name, def[i+1:])
+	if err != nil {
+		return nil, err
+	}
+	col.Type = typ
+	return col, nil
+}
+
+// ServerFieldColumn returns a column with the value at a dot separated json
+// path into the server response, named after the path.  Like a column
+// definition, the path can end in `:type`.
+func ServerFieldColumn(path string) (*Column, error) {
+	path, typ := splitColumnType(path)
+	col, err := ParseColumn(path, fmt.Sprintf(".Server %q", path))
+	if err != nil {
+		return nil, err
+	}
+	col.Type = typ
+	return col, nil
+}
+
+// splitColumnType splits the type off the end of `name:type`.  Names are
+// allowed to have colons in them, so a name that doesn't end in a known type is
+// kept whole, and is text.
+func splitColumnType(name string) (string, ColumnType) {
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		if typ, err := ParseColumnType(strings.TrimSpace(name[i+1:])); err == nil {
+			return strings.TrimSpace(name[:i]), typ
+		}
+	}
+	return name, TextColumn
+}
+
+// Value computes the column for the record
+func (c *Column) Value(r *Record) (string, error) {
+	var buf bytes.Buffer
+	if err := c.tmpl.Execute(&buf, r); err != nil {
+		return "", errors.Wrapf(err, "could not compute column `%s`", c.Name)
+	}
+	return buf.String(), nil
+}
+
+// daysBetween returns the number of whole days from a to b, or an empty string
+// if either date is missing
+func daysBetween(a, b string) (string, error) {
+	if a == "" || b == "" {
+		return "", nil
+	}
+	x, y, err := parseDates(a, b)
+	if err != nil {
+		return "", err
+	}
+	return strconv.Itoa(int(y.Sub(x) / (24 * time.Hour))), nil
+}
+
+// compareDates returns -1, 0 or 1 like compareValues, except that a missing
+// date compares equal to everything
+func compareDates(a, b string) (int, error) {
+	if a == "" || b == "" {
+		return 0, nil
+	}
+	x, y, err := parseDates(a, b)
+	switch {
+	case err != nil:
+		return 0, err
+	case x.Before(y):
+		return -1, nil
+	case x.After(y):
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func parseDates(a, b string) (x, y time.Time, err error) {
+	if x, err = ParseDate(a, time.UTC); err != nil {
+		return
+	}
+	y, err = ParseDate(b, time.UTC)
+	return
+}
@@ -0,0 +1,94 @@
+package account_test
+
+import (
+	. "github.com/wpe_merge/wpe_merge/account"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Column", func() {
+	var (
+		found = NewRecord(InRecord{"12", "jdoe", "Jane", "01/15/2020"}, &Account{
+			AccountId: 12,
+			Status:    "closed",
+			CreatedOn: "2020-03-01",
+		})
+		missing = NewRecord(InRecord{"13", "bdole", "Bob", "2020-01-15"}, nil)
+	)
+
+	DescribeTable("computing values",
+		func(def string, record *Record, expected string) {
+			col, err := ParseColumnDefinition(def)
+			Ω(err).ShouldNot(HaveOccurred())
+			actual, err := col.Value(record)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(actual).Should(Equal(expected))
+		},
+		Entry("a template", "Label={{.FirstName}} ({{.AccountId}})", found, "Jane (12)"),
+		Entry("an expression", "Name=upper .FirstName", found, "JANE"),
+		Entry("lower case", "Name=lower .FirstName", found, "jane"),
+		Entry("days between dates", "Days=days .CreatedOn .StatusSetOn", found, "46"),
+		Entry("days with a missing date", "Days=days .CreatedOn .StatusSetOn", missing, ""),
+		Entry("status changed since creation", "Changed=after .StatusSetOn .CreatedOn", found, "true"),
+		Entry("reformatting a date", "Created=date \"iso\" .CreatedOn", found, "2020-01-15"),
+		Entry("an equals sign in the expression", "Closed={{eq .Status \"closed\"}}", found, "true"),
+		Entry("a server field", "Server Status=.Server \"status\"", found, "closed"),
+		Entry("a server field when the account is missing", "Server Status=.Server \"status\"", missing, ""),
+	)
+
+	It("should return an error if the definition has no name", func() {
+		_, err := ParseColumnDefinition("upper .FirstName")
+		Ω(err).Should(HaveOccurred())
+
+		_, err = ParseColumnDefinition("=upper .FirstName")
+		Ω(err).Should(HaveOccurred())
+	})
+
+	It("should read the type of a column", func() {
+		col, err := ParseColumnDefinition("Days:integer=days .CreatedOn .StatusSetOn")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(col.Name).Should(Equal("Days"))
+		Ω(col.Type).Should(Equal(IntegerColumn))
+
+		col, err = ParseColumnDefinition("Label=upper .FirstName")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(col.Type).Should(Equal(TextColumn))
+
+		col, err = ServerFieldColumn("plan.seats:integer")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(col.Name).Should(Equal("plan.seats"))
+		Ω(col.Type).Should(Equal(IntegerColumn))
+
+		Ω(ColumnTypes([]*Column{col})).Should(Equal(map[string]ColumnType{"plan.seats": IntegerColumn}))
+	})
+
+	It("should keep colons that aren't followed by a type in the name", func() {
+		col, err := ParseColumnDefinition("Ratio: days/status=upper .Status")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(col.Name).Should(Equal("Ratio: days/status"))
+		Ω(col.Type).Should(Equal(TextColumn))
+
+		col, err = ParseColumnDefinition("Days:int=days .CreatedOn .StatusSetOn")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(col.Name).Should(Equal("Days:int"))
+
+		col, err = ServerFieldColumn("links.self:href")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(col.Name).Should(Equal("links.self:href"))
+		Ω(col.Type).Should(Equal(TextColumn))
+	})
+
+	It("should return an error if the template can't be parsed", func() {
+		_, err := ParseColumn("Name", "{{upper .FirstName")
+		Ω(err).Should(HaveOccurred())
+	})
+
+	It("should return an error if a date can't be parsed", func() {
+		col, err := ParseColumn("Days", "days .FirstName .CreatedOn")
+		Ω(err).ShouldNot(HaveOccurred())
+		_, err = col.Value(found)
+		Ω(err).Should(HaveOccurred())
+	})
+})
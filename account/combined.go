@@ -0,0 +1,69 @@
+package account
+
+import "sync"
+
+// SourceFileHeader is the name of the column that records which input a row
+// came from
+const SourceFileHeader = "Source File"
+
+// CombinedWriter merges the output of several runs into a single RecordWriter.
+// Every run starts with a header, but only the first one is written.  The runs
+// should share the same columns, since the header comes from the first run.
+type CombinedWriter struct {
+	w            RecordWriter
+	sourceColumn bool
+
+	mu          sync.Mutex
+	wroteHeader bool
+}
+
+// NewCombinedWriter instantiates a new CombinedWriter.  If sourceColumn is
+// true, a Source File column is added to the end of every row.
+func NewCombinedWriter(w RecordWriter, sourceColumn bool) *CombinedWriter {
+	return &CombinedWriter{w: w, sourceColumn: sourceColumn}
+}
+
+// Source returns the RecordWriter for a single run over the named input
+func (c *CombinedWriter) Source(name string) RecordWriter {
+	return &sourceWriter{c: c, name: name}
+}
+
+type sourceWriter struct {
+	c          *CombinedWriter
+	name       string
+	seenHeader bool
+}
+
+func (w *sourceWriter) Write(record []string) error {
+	w.c.mu.Lock()
+	defer w.c.mu.Unlock()
+
+	if !w.seenHeader {
+		w.seenHeader = true
+		if w.c.wroteHeader {
+			return nil
+		}
+		w.c.wroteHeader = true
+		if w.c.sourceColumn {
+			record = append(record[:len(record):len(record)], SourceFileHeader)
+		}
+		return w.c.w.Write(record)
+	}
+
+	if w.c.sourceColumn {
+		record = append(record[:len(record):len(record)], w.name)
+	}
+	return w.c.w.Write(record)
+}
+
+func (w *sourceWriter) Flush() {
+	w.c.mu.Lock()
+	defer w.c.mu.Unlock()
+	w.c.w.Flush()
+}
+
+func (w *sourceWriter) Error() error {
+	w.c.mu.Lock()
+	defer w.c.mu.Unlock()
+	return w.c.w.Error()
+}
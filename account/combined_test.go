@@ -0,0 +1,41 @@
+package account_test
+
+import (
+	"bytes"
+	"encoding/csv"
+
+	. "github.com/wpe_merge/wpe_merge/account"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CombinedWriter", func() {
+	write := func(w RecordWriter, records ...[]string) {
+		for _, record := range records {
+			Ω(w.Write(record)).Should(Succeed())
+		}
+		w.Flush()
+		Ω(w.Error()).Should(Succeed())
+	}
+
+	It("should only write the first header", func() {
+		var buf bytes.Buffer
+		combined := NewCombinedWriter(csv.NewWriter(&buf), false)
+
+		write(combined.Source("a.csv"), []string{"Account ID"}, []string{"1"})
+		write(combined.Source("b.csv"), []string{"Account ID"}, []string{"2"})
+
+		Ω(buf.String()).Should(Equal("Account ID\n1\n2\n"))
+	})
+
+	It("should add the source file column", func() {
+		var buf bytes.Buffer
+		combined := NewCombinedWriter(csv.NewWriter(&buf), true)
+
+		write(combined.Source("a.csv"), []string{"Account ID"}, []string{"1"})
+		write(combined.Source("b.csv"), []string{"Account ID"}, []string{"2"})
+
+		Ω(buf.String()).Should(Equal("Account ID,Source File\n1,a.csv\n2,b.csv\n"))
+	})
+})
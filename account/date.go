@@ -0,0 +1,77 @@
+package account
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrInvalidDate is an error generated when a date does not match any of
+	// the supported layouts
+	ErrInvalidDate = errors.New("invalid date")
+
+	// inDateLayouts are the layouts we know how to read, in the order they are
+	// tried.  Layouts with a zone come first so that the zone is preserved.
+	inDateLayouts = []string{
+		time.RFC3339Nano,
+		"2006-01-02T15:04:05",
+		"2006-01-02",
+		"01/02/2006",
+	}
+
+	// dateFormats are friendlier names for common output layouts
+	dateFormats = map[string]string{
+		"iso":     "2006-01-02",
+		"us":      "01/02/2006",
+		"rfc3339": time.RFC3339,
+	}
+)
+
+// DateFormatter converts dates from any of the supported input layouts into a
+// single output layout and time zone
+type DateFormatter struct {
+	layout string
+	loc    *time.Location
+}
+
+// NewDateFormatter instantiates a new DateFormatter.  The layout is either a go
+// time layout or one of "iso", "us" or "rfc3339".  A nil location means UTC.
+func NewDateFormatter(layout string, loc *time.Location) *DateFormatter {
+	if named, ok := dateFormats[strings.ToLower(layout)]; ok {
+		layout = named
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	return &DateFormatter{layout: layout, loc: loc}
+}
+
+// Parse reads the date in any of the supported layouts.  Dates without a zone
+// are assumed to be in the formatter's time zone.
+func (f *DateFormatter) Parse(value string) (time.Time, error) {
+	return ParseDate(value, f.loc)
+}
+
+// Format converts the date into the formatter's layout and time zone
+func (f *DateFormatter) Format(value string) (string, error) {
+	t, err := f.Parse(value)
+	if err != nil {
+		return "", err
+	}
+	return t.In(f.loc).Format(f.layout), nil
+}
+
+// ParseDate reads the date in any of the supported layouts (ISO 8601, US
+// MM/DD/YYYY and RFC 3339).  Dates without a zone are read in the provided
+// location.
+func ParseDate(value string, loc *time.Location) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range inDateLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.Wrapf(ErrInvalidDate, "could not parse `%s`", value)
+}
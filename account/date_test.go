@@ -0,0 +1,38 @@
+package account_test
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/wpe_merge/wpe_merge/account"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DateFormatter", func() {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		panic(err)
+	}
+
+	DescribeTable("formatting dates",
+		func(layout string, loc *time.Location, value, expected string) {
+			actual, err := NewDateFormatter(layout, loc).Format(value)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(actual).Should(Equal(expected))
+		},
+		Entry("ISO 8601 to US", "us", nil, "2020-01-22", "01/22/2020"),
+		Entry("US to ISO 8601", "iso", nil, "01/22/2020", "2020-01-22"),
+		Entry("ISO 8601 date time", "iso", nil, "2020-01-22T23:00:00", "2020-01-22"),
+		Entry("RFC 3339 into another zone", "iso", newYork, "2020-01-22T02:00:00Z", "2020-01-21"),
+		Entry("RFC 3339 with fractional seconds", "rfc3339", nil, "2020-01-22T02:00:00.123+01:00", "2020-01-22T01:00:00Z"),
+		Entry("a go layout", "Jan 2, 2006", nil, "2020-01-22", "Jan 22, 2020"),
+	)
+
+	It("should return an error if the date can't be parsed", func() {
+		_, err := NewDateFormatter("iso", nil).Format("22.01.2020")
+		Ω(errors.Cause(err)).Should(Equal(ErrInvalidDate))
+	})
+})
@@ -0,0 +1,114 @@
+package account
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// DedupePolicy decides what happens to rows that share an account id
+type DedupePolicy string
+
+const (
+	// DedupeKeepAll writes every row, duplicates included
+	DedupeKeepAll DedupePolicy = "keep-all"
+	// DedupeKeepFirst writes the first row for each account id and drops the
+	// rest without looking them up
+	DedupeKeepFirst DedupePolicy = "keep-first"
+	// DedupeKeepLast writes the last row for each account id
+	DedupeKeepLast DedupePolicy = "keep-last"
+	// DedupeMerge writes one row for each account id, where each column comes
+	// from the last row that has a value for it
+	DedupeMerge DedupePolicy = "merge"
+)
+
+// ParseDedupePolicy validates the name of a dedupe policy
+func ParseDedupePolicy(name string) (DedupePolicy, error) {
+	switch policy := DedupePolicy(name); policy {
+	case DedupeKeepAll, DedupeKeepFirst, DedupeKeepLast, DedupeMerge:
+		return policy, nil
+	}
+	return "", errors.Errorf("unknown dedupe policy `%s`", name)
+}
+
+// dedupeBuffer holds output rows until the whole input has been read, since we
+// can't know which row is the last one for an account id until then.  When the
+// input is read in parallel, the same goes for the first one.  This
+// means memory grows with the size of the output.
+type dedupeBuffer struct {
+	mu     sync.Mutex
+	policy DedupePolicy
+	mem    *budget
+	rows   map[string][]dedupeRow
+	order  []string
+}
+
+type dedupeRow struct {
+	index  int64
+	record []string
+}
+
+func newDedupeBuffer(policy DedupePolicy, mem *budget) *dedupeBuffer {
+	return &dedupeBuffer{
+		policy: policy,
+		mem:    mem,
+		rows:   make(map[string][]dedupeRow),
+	}
+}
+
+// add holds on to a row.  The index is the position of the row in the input,
+// which may differ from the order rows are added in.
+func (b *dedupeBuffer) add(accountId string, index int64, record []string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	rows, ok := b.rows[accountId]
+	row := dedupeRow{index: index, record: record}
+	switch {
+	case !ok:
+		if err := b.mem.reserve(seenIdSize + int64(len(accountId)) + recordSize(record)); err != nil {
+			return err
+		}
+		b.order = append(b.order, accountId)
+		b.rows[accountId] = []dedupeRow{row}
+	case b.policy == DedupeMerge:
+		if err := b.mem.reserve(recordSize(record)); err != nil {
+			return err
+		}
+		b.rows[accountId] = append(rows, row)
+	case b.policy == DedupeKeepFirst && index < rows[0].index,
+		b.policy == DedupeKeepLast && index > rows[0].index:
+		if err := b.mem.reserve(recordSize(record) - recordSize(rows[0].record)); err != nil {
+			return err
+		}
+		b.rows[accountId] = []dedupeRow{row}
+	}
+	return nil
+}
+
+// records returns one row per account id, in the order each account id was
+// first added
+func (b *dedupeBuffer) records() [][]string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	records := make([][]string, 0, len(b.order))
+	for _, accountId := range b.order {
+		rows := b.rows[accountId]
+		sort.Slice(rows, func(i, j int) bool {
+			return rows[i].index < rows[j].index
+		})
+
+		record := append([]string{}, rows[0].record...)
+		for _, row := range rows[1:] {
+			for i, value := range row.record {
+				if value != "" {
+					record[i] = value
+				}
+			}
+		}
+		records = append(records, record)
+	}
+	return records
+}
@@ -0,0 +1,102 @@
+package account
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DryRunSummary is what a dry run found out about an input
+type DryRunSummary struct {
+	// Rows is the number of rows read from the input, not including the header
+	Rows int64
+	// Valid is the number of rows that passed validation
+	Valid int64
+	// Invalid is the number of rows rejected by validation
+	Invalid int64
+	// Duplicates is the number of valid rows whose account id was already seen
+	Duplicates int64
+	// Requests is the most requests a run would make, taking the batch size
+	// into account.  Duplicates that are looked up at the same time share a
+	// request, so a run may make fewer.
+	Requests int64
+}
+
+// Add combines the counts from another summary into this one
+func (sum *DryRunSummary) Add(other *DryRunSummary) {
+	sum.Rows += other.Rows
+	sum.Valid += other.Valid
+	sum.Invalid += other.Invalid
+	sum.Duplicates += other.Duplicates
+	sum.Requests += other.Requests
+}
+
+// Estimate returns roughly how long the requests would take with n of them in
+// flight at a time, if each one takes latency
+func (sum *DryRunSummary) Estimate(n int64, latency time.Duration) time.Duration {
+	if n <= 0 {
+		n = 1
+	}
+	batches := (sum.Requests + n - 1) / n
+	return time.Duration(batches) * latency
+}
+
+// DryRun reads and checks the input the same way a run would, but doesn't look
+// anything up or write any output.  Rejected rows are still reported.
+func (s *WPStreamer) DryRun(ctx context.Context, r io.Reader) (*DryRunSummary, error) {
+	sum := &DryRunSummary{}
+	defer s.flushErrors(ctx)
+
+	cr := csv.NewReader(r)
+	if err := readHeader(cr); err != nil {
+		return sum, err
+	}
+
+	var (
+		seen    = make(map[string]struct{})
+		lookups int64
+	)
+	// every batch is a single request
+	defer func() {
+		size := int64(s.batchSize)
+		sum.Requests = (lookups + size - 1) / size
+	}()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return sum, err
+		}
+
+		raw, err := cr.Read()
+		if err == io.EOF {
+			return sum, nil
+		} else if err != nil {
+			return sum, errors.Wrap(err, "could not read row")
+		}
+
+		inRecord := InRecord(raw)
+		sum.Rows++
+
+		if s.validator != nil {
+			if err := s.validator.Validate(inRecord); err != nil {
+				sum.Invalid++
+				s.rowError(ctx, inRecord, errors.Wrap(err, "invalid row"))
+				continue
+			}
+		}
+		sum.Valid++
+
+		accountId := normalizeAccountId(inRecord.AccountId())
+		if _, ok := seen[accountId]; ok {
+			sum.Duplicates++
+			if s.dedupe == DedupeKeepFirst {
+				continue
+			}
+		}
+		seen[accountId] = struct{}{}
+		lookups++
+	}
+}
@@ -0,0 +1,96 @@
+package account_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"io"
+	"time"
+
+	. "github.com/wpe_merge/wpe_merge/account"
+	"github.com/wpe_merge/wpe_merge/account/mocks"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DryRun", func() {
+	var (
+		T = GinkgoT()
+
+		ctx    context.Context
+		cancel context.CancelFunc
+		client *mocks.Client
+	)
+
+	BeforeEach(func() {
+		client = &mocks.Client{}
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+		// nothing should have been looked up
+		client.AssertExpectations(T)
+	})
+
+	getReader := func(records [][]string) io.Reader {
+		var buf bytes.Buffer
+		Ω(csv.NewWriter(&buf).WriteAll(records)).Should(Succeed())
+		return &buf
+	}
+
+	records := [][]string{
+		{"Account ID", "Account Name", "First Name", "Created On"},
+		{"1", "jdoe", "Jane", "2020-01-01"},
+		{"bob", "bdole", "Bob", "2020-02-02"},
+		{"01", "jdoe", "Janet", "2020-03-03"},
+		{"2", "gknight", "", "2020-04-04"},
+		{"3", "gknight", "Gladys", "2020-05-05"},
+	}
+
+	It("should count the rows without looking them up", func() {
+		streamer := NewWPStreamer(client, WithValidator(NewValidator(DefaultRules(0)...)))
+		sum, err := streamer.DryRun(ctx, getReader(records))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(*sum).Should(Equal(DryRunSummary{Rows: 5, Valid: 3, Invalid: 2, Duplicates: 1, Requests: 3}))
+	})
+
+	It("should not count requests for duplicates that would be skipped", func() {
+		streamer := NewWPStreamer(client, WithDedupePolicy(DedupeKeepFirst))
+		sum, err := streamer.DryRun(ctx, getReader(records))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(*sum).Should(Equal(DryRunSummary{Rows: 5, Valid: 5, Duplicates: 1, Requests: 4}))
+	})
+
+	It("should count a request for every batch", func() {
+		streamer := NewWPStreamer(client, WithBatchSize(2))
+		sum, err := streamer.DryRun(ctx, getReader(records))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(sum.Requests).Should(BeEquivalentTo(3))
+	})
+
+	It("should report rejected rows to the error writer", func() {
+		var errs bytes.Buffer
+		streamer := NewWPStreamer(client,
+			WithValidator(NewValidator(DefaultRules(0)...)),
+			WithErrorWriter(&errs))
+		_, err := streamer.DryRun(ctx, getReader(records))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		rows, err := csv.NewReader(&errs).ReadAll()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(rows).Should(HaveLen(3))
+	})
+
+	It("should return an error if the header is invalid", func() {
+		streamer := NewWPStreamer(client)
+		_, err := streamer.DryRun(ctx, getReader([][]string{{"Account ID", "Name", "First Name", "Created On"}}))
+		Ω(err).Should(MatchError("could not read header: invalid header"))
+	})
+
+	It("should estimate how long the requests would take", func() {
+		sum := &DryRunSummary{Requests: 25}
+		Ω(sum.Estimate(10, 100*time.Millisecond)).Should(Equal(300 * time.Millisecond))
+	})
+})
@@ -0,0 +1,48 @@
+package account
+
+import (
+	"github.com/pkg/errors"
+)
+
+// FailurePolicy decides whether a failed lookup stops the run
+type FailurePolicy string
+
+const (
+	// FailureContinue reports the row and writes it without the server's data
+	FailureContinue FailurePolicy = "continue"
+	// FailureAbortOnOpen continues like FailureContinue, but stops the run
+	// once a circuit breaker has opened, since the rest of the lookups would
+	// fail too
+	FailureAbortOnOpen FailurePolicy = "abort-on-open"
+	// FailureAbort stops the run at the first lookup that fails.  Accounts
+	// that don't exist aren't failures.
+	FailureAbort FailurePolicy = "abort"
+)
+
+// ParseFailurePolicy validates the name of a failure policy
+func ParseFailurePolicy(name string) (FailurePolicy, error) {
+	switch policy := FailurePolicy(name); policy {
+	case FailureContinue, FailureAbortOnOpen, FailureAbort:
+		return policy, nil
+	}
+	return "", errors.Errorf("unknown failure policy `%s`", name)
+}
+
+// WithFailurePolicy returns a WPStreamerOption that decides whether a failed
+// lookup stops the run
+func WithFailurePolicy(policy FailurePolicy) WPStreamerOption {
+	return func(s *WPStreamer) {
+		s.onFailure = policy
+	}
+}
+
+// abort returns true if the lookup error should stop the run
+func (policy FailurePolicy) abort(err error) bool {
+	switch policy {
+	case FailureAbortOnOpen:
+		return errors.Cause(err) == ErrCircuitOpen
+	case FailureAbort:
+		return !IsNotFound(err)
+	}
+	return false
+}
@@ -0,0 +1,394 @@
+package account
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// Filter is a parsed filter expression that decides which merged records make
+// it into the output.  Expressions look like
+//
+//	status in ("closed", "suspended") && created_on < 2020-01-01
+//
+// Fields are referred to by their snake case names (account_id, account_name,
+// first_name, created_on, status, status_set_on).  Values can be quoted
+// strings, numbers or dates.  Comparisons are numeric if both sides are
+// numbers, chronological if both sides are dates, and alphabetical otherwise.
+// Conditions can be combined with &&, || and !, or "and", "or" and "not", and
+// grouped with parentheses.
+type Filter struct {
+	src  string
+	root condition
+}
+
+// ParseFilter parses a filter expression
+func ParseFilter(src string) (*Filter, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not parse filter")
+	}
+	p := &filterParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err == nil && p.peek().kind != tokEOF {
+		err = p.unexpected()
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "could not parse filter")
+	}
+	return &Filter{src: src, root: root}, nil
+}
+
+// Match returns true if the record satisfies the filter
+func (f *Filter) Match(r *Record) bool {
+	return f.root.eval(r)
+}
+
+func (f *Filter) String() string {
+	return f.src
+}
+
+// condition is a node in the expression that evaluates to true or false
+type condition interface {
+	eval(r *Record) bool
+}
+
+// operand is a node in the expression that evaluates to a value
+type operand interface {
+	value(r *Record) string
+}
+
+type andCondition struct{ left, right condition }
+
+func (c andCondition) eval(r *Record) bool { return c.left.eval(r) && c.right.eval(r) }
+
+type orCondition struct{ left, right condition }
+
+func (c orCondition) eval(r *Record) bool { return c.left.eval(r) || c.right.eval(r) }
+
+type notCondition struct{ cond condition }
+
+func (c notCondition) eval(r *Record) bool { return !c.cond.eval(r) }
+
+type compareCondition struct {
+	op          string
+	left, right operand
+}
+
+func (c compareCondition) eval(r *Record) bool {
+	left, right := c.left.value(r), c.right.value(r)
+	// an empty field has no order, so it is neither before nor after anything
+	if (left == "" || right == "") && c.op != "==" && c.op != "!=" {
+		return false
+	}
+	n := compareValues(left, right)
+	switch c.op {
+	case "==":
+		return n == 0
+	case "!=":
+		return n != 0
+	case "<":
+		return n < 0
+	case "<=":
+		return n <= 0
+	case ">":
+		return n > 0
+	case ">=":
+		return n >= 0
+	}
+	return false
+}
+
+type inCondition struct {
+	left   operand
+	values []operand
+}
+
+func (c inCondition) eval(r *Record) bool {
+	left := c.left.value(r)
+	for _, value := range c.values {
+		if compareValues(left, value.value(r)) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+type fieldOperand struct {
+	get func(r *Record) string
+}
+
+func (o fieldOperand) value(r *Record) string { return o.get(r) }
+
+type literalOperand string
+
+func (o literalOperand) value(r *Record) string { return string(o) }
+
+// compareValues compares two values as numbers, then as dates and finally as
+// strings, returning -1, 0 or 1
+func compareValues(a, b string) int {
+	if x, err := strconv.ParseFloat(a, 64); err == nil {
+		if y, err := strconv.ParseFloat(b, 64); err == nil {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	if x, err := ParseDate(a, time.UTC); err == nil {
+		if y, err := ParseDate(b, time.UTC); err == nil {
+			switch {
+			case x.Before(y):
+				return -1
+			case x.After(y):
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokOp
+	tokString
+	tokWord
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// operators are listed longest first so that "<=" isn't read as "<"
+var filterOperators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")", ","}
+
+func tokenize(src string) ([]token, error) {
+	var (
+		tokens []token
+		runes  = []rune(src)
+	)
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"' || c == '\'':
+			start := i
+			var sb strings.Builder
+			for i++; i < len(runes) && runes[i] != c; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				sb.WriteRune(runes[i])
+			}
+			if i >= len(runes) {
+				return nil, errors.Errorf("unterminated string at position %d", start+1)
+			}
+			i++
+			tokens = append(tokens, token{kind: tokString, text: sb.String(), pos: start})
+		case isWordRune(c):
+			start := i
+			for i < len(runes) && isWordRune(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokWord, text: string(runes[start:i]), pos: start})
+		default:
+			matched := false
+			for _, op := range filterOperators {
+				if strings.HasPrefix(string(runes[i:]), op) {
+					tokens = append(tokens, token{kind: tokOp, text: op, pos: i})
+					i += len([]rune(op))
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, errors.Errorf("unexpected `%c` at position %d", c, i+1)
+			}
+		}
+	}
+	return append(tokens, token{kind: tokEOF, pos: len(runes)}), nil
+}
+
+// isWordRune matches the characters in field names, numbers and dates
+func isWordRune(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c) || strings.ContainsRune("_-/:.+", c)
+}
+
+type filterParser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *filterParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token if it is one of the operators or keywords
+func (p *filterParser) accept(texts ...string) bool {
+	t := p.peek()
+	if t.kind != tokOp && t.kind != tokWord {
+		return false
+	}
+	for _, text := range texts {
+		if strings.EqualFold(t.text, text) {
+			p.pos++
+			return true
+		}
+	}
+	return false
+}
+
+func (p *filterParser) expect(text string) error {
+	if !p.accept(text) {
+		return p.unexpected()
+	}
+	return nil
+}
+
+func (p *filterParser) unexpected() error {
+	t := p.peek()
+	if t.kind == tokEOF {
+		return errors.New("unexpected end of expression")
+	}
+	return errors.Errorf("unexpected `%s` at position %d", t.text, t.pos+1)
+}
+
+func (p *filterParser) parseOr() (condition, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||", "or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orCondition{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (condition, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&", "and") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andCondition{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseNot() (condition, error) {
+	if p.accept("!", "not") {
+		cond, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notCondition{cond}, nil
+	}
+	if p.accept("(") {
+		cond, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return cond, p.expect(")")
+	}
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (condition, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	negate := p.accept("not")
+	if p.accept("in") {
+		values, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		var cond condition = inCondition{left, values}
+		if negate {
+			cond = notCondition{cond}
+		}
+		return cond, nil
+	} else if negate {
+		return nil, p.unexpected()
+	}
+
+	op := p.peek()
+	if !p.accept("==", "!=", "<", "<=", ">", ">=") {
+		return nil, p.unexpected()
+	}
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	return compareCondition{op: op.text, left: left, right: right}, nil
+}
+
+func (p *filterParser) parseList() ([]operand, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var values []operand
+	for {
+		value, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		if !p.accept(",") {
+			break
+		}
+	}
+	return values, p.expect(")")
+}
+
+func (p *filterParser) parseOperand() (operand, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokString:
+		p.next()
+		return literalOperand(t.text), nil
+	case tokWord:
+		p.next()
+		// words that start with a letter are field names, everything else is
+		// a number or a date
+		if unicode.IsLetter([]rune(t.text)[0]) {
+			get, ok := recordFields[strings.ToLower(t.text)]
+			if !ok {
+				return nil, errors.Errorf("unknown field `%s` at position %d", t.text, t.pos+1)
+			}
+			return fieldOperand{get}, nil
+		}
+		return literalOperand(t.text), nil
+	}
+	return nil, p.unexpected()
+}
@@ -0,0 +1,70 @@
+package account_test
+
+import (
+	. "github.com/wpe_merge/wpe_merge/account"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Filter", func() {
+	record := NewRecord(InRecord{"12", "jdoe", "Jane", "01/15/2020"}, &Account{
+		AccountId: 12,
+		Status:    "closed",
+		CreatedOn: "2020-03-01",
+	})
+
+	DescribeTable("matching records",
+		func(src string, expected bool) {
+			f, err := ParseFilter(src)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(f.Match(record)).Should(Equal(expected))
+		},
+		Entry("equal strings", `status == "closed"`, true),
+		Entry("single quoted strings", `status == 'closed'`, true),
+		Entry("not equal strings", `status != "closed"`, false),
+		Entry("in a list", `status in ("closed", "suspended")`, true),
+		Entry("not in a list", `status not in ("closed", "suspended")`, false),
+		Entry("numbers", `account_id > 9`, true),
+		Entry("dates in different layouts", `created_on < 2020-02-01`, true),
+		Entry("two fields", `status_set_on > created_on`, true),
+		Entry("and", `status == "closed" && created_on >= 2020-02-01`, false),
+		Entry("or", `status == "open" || first_name == "Jane"`, true),
+		Entry("words", `status == "open" or not first_name == "Bob"`, true),
+		Entry("parentheses", `!(status == "open" || account_id <= 12)`, false),
+	)
+
+	DescribeTable("parse errors",
+		func(src string) {
+			_, err := ParseFilter(src)
+			Ω(err).Should(HaveOccurred())
+		},
+		Entry("unknown field", `last_name == "Doe"`),
+		Entry("missing operator", `status "closed"`),
+		Entry("unterminated string", `status == "closed`),
+		Entry("unbalanced parentheses", `(status == "closed"`),
+		Entry("trailing tokens", `status == "closed" )`),
+		Entry("empty list", `status in ()`),
+		Entry("bad character", `status == "closed" ; drop`),
+	)
+
+	It("should compare fields of records that weren't found as empty", func() {
+		f, err := ParseFilter(`status == ""`)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(f.Match(NewRecord(InRecord{"1", "jdoe", "Jane", "2020-01-01"}, nil))).Should(BeTrue())
+	})
+
+	It("should not order empty fields", func() {
+		missing := NewRecord(InRecord{"1", "jdoe", "Jane", "2020-01-01"}, nil)
+		for _, src := range []string{`status_set_on < 2020-02-01`, `status_set_on <= 2020-02-01`, `status_set_on > created_on`, `status >= ""`} {
+			f, err := ParseFilter(src)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(f.Match(missing)).Should(BeFalse(), src)
+		}
+
+		f, err := ParseFilter(`status_set_on != 2020-02-01`)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(f.Match(missing)).Should(BeTrue())
+	})
+})
@@ -0,0 +1,236 @@
+package account
+
+import (
+	"context"
+	"expvar"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// hedgeSamples is how many of the latest latencies the hedge delay is
+	// worked out from
+	hedgeSamples = 1000
+	// minHedgeSamples is how many latencies are needed before hedging starts
+	minHedgeSamples = 20
+	// hedgeRecompute is how often the delay is worked out again, in samples
+	hedgeRecompute = 50
+)
+
+// hedgeMetrics is published under account_hedge in expvar.  All hedging
+// clients share it.
+var hedgeMetrics = expvar.NewMap("account_hedge")
+
+// HedgeOption is an option that can be passed into the HedgingClient
+type HedgeOption func(h *HedgingClient)
+
+// WithHedgeBudget returns a HedgeOption that limits hedges to this share of the
+// calls, so a slow server doesn't get twice the load.  The default is 0.1.
+func WithHedgeBudget(ratio float64) HedgeOption {
+	if ratio < 0 || ratio > 1 {
+		panic("hedge budget must be between 0 and 1")
+	}
+	return func(h *HedgingClient) {
+		h.budget = ratio
+	}
+}
+
+// WithHedgePercentile returns a HedgeOption that sends a hedge once a call has
+// taken longer than this percentile of recent calls.  The default is 0.95.
+func WithHedgePercentile(p float64) HedgeOption {
+	if p <= 0 || p >= 1 {
+		panic("hedge percentile must be between 0 and 1")
+	}
+	return func(h *HedgingClient) {
+		h.percentile = p
+	}
+}
+
+// WithHedgeDelay returns a HedgeOption that sends a hedge after a fixed delay
+// instead of one worked out from recent calls
+func WithHedgeDelay(d time.Duration) HedgeOption {
+	return func(h *HedgingClient) {
+		h.fixedDelay = d
+	}
+}
+
+// HedgingClient is a Client that sends a second copy of a call that is taking
+// longer than usual and takes whichever answers first, which cuts off the long
+// tail of slow requests.  Hedges are sent on top of the streamer's limit on
+// concurrent requests, up to the budget.  GetAccounts isn't hedged.
+type HedgingClient struct {
+	Client
+
+	budget     float64
+	percentile float64
+	fixedDelay time.Duration
+
+	calls, hedges int64
+
+	single, bulk latencies
+}
+
+var _ Client = &HedgingClient{}
+
+// NewHedgingClient wraps a client with hedging
+func NewHedgingClient(client Client, ops ...HedgeOption) *HedgingClient {
+	h := &HedgingClient{
+		Client:     client,
+		budget:     0.1,
+		percentile: 0.95,
+	}
+	for _, op := range ops {
+		op(h)
+	}
+	return h
+}
+
+func (h *HedgingClient) GetAccount(ctx context.Context, req *GetAccountRequest) (*Account, error) {
+	resp, err := h.hedge(ctx, &h.single, func(ctx context.Context) (interface{}, error) {
+		return h.Client.GetAccount(ctx, req)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*Account), nil
+}
+
+func (h *HedgingClient) GetAccountsByIDs(ctx context.Context, ids []string) (*GetAccountsResponse, error) {
+	// batches take longer than single lookups, so they get their own delay
+	resp, err := h.hedge(ctx, &h.bulk, func(ctx context.Context) (interface{}, error) {
+		return h.Client.GetAccountsByIDs(ctx, ids)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*GetAccountsResponse), nil
+}
+
+type hedgeResult struct {
+	resp  interface{}
+	err   error
+	hedge bool
+}
+
+// hedge makes the call, and a second one if the first is slow.  The first
+// answer wins, where an answer is anything but a server failure; if both fail
+// the last error is returned.
+//
+// The latency recorded is the time since the first call was sent, even when
+// the hedge wins.  The first call would have taken at least that long, and
+// recording how long the hedge took would pull the delay down every time a
+// hedge won, until nearly every call was hedged.
+func (h *HedgingClient) hedge(ctx context.Context, lat *latencies, call func(context.Context) (interface{}, error)) (interface{}, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	start := time.Now()
+	results := make(chan hedgeResult, 2)
+	send := func(hedge bool) {
+		go func() {
+			resp, err := call(ctx)
+			results <- hedgeResult{resp: resp, err: err, hedge: hedge}
+		}()
+	}
+	atomic.AddInt64(&h.calls, 1)
+	hedgeMetrics.Add("calls", 1)
+	send(false)
+	pending := 1
+
+	var timeout <-chan time.Time
+	if delay, ok := h.delay(lat); ok {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for {
+		select {
+		case <-timeout:
+			timeout = nil
+			if h.spend() {
+				hedgeMetrics.Add("sent", 1)
+				send(true)
+				pending++
+			}
+		case res := <-results:
+			pending--
+			if res.err == nil || !isServerFailure(res.err) || pending == 0 {
+				if res.err == nil {
+					lat.add(time.Since(start))
+				}
+				if res.hedge && res.err == nil {
+					hedgeMetrics.Add("won", 1)
+				}
+				return res.resp, res.err
+			}
+		}
+	}
+}
+
+// spend takes a hedge out of the budget, if there is any left
+func (h *HedgingClient) spend() bool {
+	calls := atomic.LoadInt64(&h.calls)
+	for {
+		hedges := atomic.LoadInt64(&h.hedges)
+		if float64(hedges+1) > h.budget*float64(calls) {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&h.hedges, hedges, hedges+1) {
+			return true
+		}
+	}
+}
+
+// delay returns how long to wait before hedging, or false if it is too early
+// to tell
+func (h *HedgingClient) delay(lat *latencies) (time.Duration, bool) {
+	if h.fixedDelay > 0 {
+		return h.fixedDelay, true
+	}
+	return lat.percentile(h.percentile)
+}
+
+// latencies keeps the latest call latencies
+type latencies struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+	added   int
+	cached  time.Duration
+	stale   bool
+}
+
+func (l *latencies) add(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.samples) < hedgeSamples {
+		l.samples = append(l.samples, d)
+	} else {
+		l.samples[l.next] = d
+		l.next = (l.next + 1) % hedgeSamples
+	}
+	l.added++
+	if l.added%hedgeRecompute == 0 || len(l.samples) <= minHedgeSamples {
+		l.stale = true
+	}
+}
+
+// percentile returns the latency that p of the samples are under.  It is only
+// worked out every so often, since it means sorting the samples.
+func (l *latencies) percentile(p float64) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.samples) < minHedgeSamples {
+		return 0, false
+	}
+	if l.stale {
+		sorted := append([]time.Duration{}, l.samples...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		l.cached = sorted[int(p*float64(len(sorted)-1))]
+		l.stale = false
+	}
+	return l.cached, true
+}
@@ -0,0 +1,164 @@
+package account_test
+
+import (
+	"context"
+	"expvar"
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/wpe_merge/wpe_merge/account"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func hedgeMetric(name string) int64 {
+	v := expvar.Get("account_hedge").(*expvar.Map).Get(name)
+	if v == nil {
+		return 0
+	}
+	return v.(*expvar.Int).Value()
+}
+
+var _ = Describe("HedgingClient", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	// timed makes a call and returns how long it took
+	timed := func(c Client) (time.Duration, error) {
+		start := time.Now()
+		_, err := c.GetAccount(ctx, &GetAccountRequest{AccountId: "1"})
+		return time.Since(start), err
+	}
+
+	It("should take the hedge when it answers first", func() {
+		laggy := &fakeClient{behave: func(call int64, _ int) (time.Duration, error) {
+			if call == 1 {
+				return time.Second, nil
+			}
+			return 0, nil
+		}}
+		sent, won := hedgeMetric("sent"), hedgeMetric("won")
+
+		hedging := NewHedgingClient(laggy, WithHedgeDelay(10*time.Millisecond), WithHedgeBudget(1))
+		took, err := timed(hedging)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(took).Should(BeNumerically("<", 500*time.Millisecond))
+		Ω(laggy.Calls()).Should(BeEquivalentTo(2))
+		Ω(hedgeMetric("sent") - sent).Should(BeEquivalentTo(1))
+		Ω(hedgeMetric("won") - won).Should(BeEquivalentTo(1))
+	})
+
+	It("should not hedge a call that answers in time", func() {
+		laggy := &fakeClient{behave: func(int64, int) (time.Duration, error) { return 0, nil }}
+		hedging := NewHedgingClient(laggy, WithHedgeDelay(50*time.Millisecond), WithHedgeBudget(1))
+		for i := 0; i < 5; i++ {
+			_, err := timed(hedging)
+			Ω(err).ShouldNot(HaveOccurred())
+		}
+		Ω(laggy.Calls()).Should(BeEquivalentTo(5))
+	})
+
+	It("should wait for some latencies before hedging", func() {
+		laggy := &fakeClient{behave: func(call int64, _ int) (time.Duration, error) {
+			if call == 1 || call == 22 {
+				return 200 * time.Millisecond, nil
+			}
+			return time.Millisecond, nil
+		}}
+		hedging := NewHedgingClient(laggy, WithHedgeBudget(1))
+
+		// too early to know what slow is
+		took, err := timed(hedging)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(took).Should(BeNumerically(">=", 200*time.Millisecond))
+
+		for i := 0; i < 20; i++ {
+			_, err := timed(hedging)
+			Ω(err).ShouldNot(HaveOccurred())
+		}
+		Ω(laggy.Calls()).Should(BeEquivalentTo(21))
+
+		// now a slow call stands out
+		took, err = timed(hedging)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(took).Should(BeNumerically("<", 200*time.Millisecond))
+		Ω(laggy.Calls()).Should(BeEquivalentTo(23))
+	})
+
+	It("should keep the delay steady when hedges win", func() {
+		// a fifth of the calls take 10ms to 50ms, so the 90th percentile
+		// is 30ms and only the 40ms and 50ms calls are worth hedging.  If
+		// the delay drifted down, every slow call would be hedged.
+		laggy := &fakeClient{behave: func(call int64, _ int) (time.Duration, error) {
+			if call%5 == 0 {
+				return time.Duration(10*(call/5%5+1)) * time.Millisecond, nil
+			}
+			return 0, nil
+		}}
+		hedging := NewHedgingClient(laggy, WithHedgePercentile(0.9), WithHedgeBudget(1))
+		sent := hedgeMetric("sent")
+
+		const calls = 300
+		for i := 0; i < calls; i++ {
+			_, err := timed(hedging)
+			Ω(err).ShouldNot(HaveOccurred())
+		}
+		Ω(hedgeMetric("sent") - sent).Should(BeNumerically("<", calls*3/20))
+	})
+
+	It("should stay within the budget", func() {
+		laggy := &fakeClient{behave: func(int64, int) (time.Duration, error) { return 20 * time.Millisecond, nil }}
+		hedging := NewHedgingClient(laggy, WithHedgeDelay(time.Millisecond), WithHedgeBudget(0.25))
+		for i := 0; i < 20; i++ {
+			_, err := timed(hedging)
+			Ω(err).ShouldNot(HaveOccurred())
+		}
+		Ω(laggy.Calls()).Should(BeNumerically("<=", 25))
+	})
+
+	It("should not hedge a call that already failed", func() {
+		laggy := &fakeClient{behave: func(int64, int) (time.Duration, error) {
+			return 0, errors.New("connection refused")
+		}}
+		hedging := NewHedgingClient(laggy, WithHedgeDelay(10*time.Millisecond), WithHedgeBudget(1))
+		_, err := timed(hedging)
+		Ω(err).Should(HaveOccurred())
+		Ω(laggy.Calls()).Should(BeEquivalentTo(1))
+	})
+
+	It("should wait for the hedge if the first call fails", func() {
+		laggy := &fakeClient{behave: func(call int64, _ int) (time.Duration, error) {
+			if call == 1 {
+				return 50 * time.Millisecond, errors.New("connection reset")
+			}
+			return 100 * time.Millisecond, nil
+		}}
+		hedging := NewHedgingClient(laggy, WithHedgeDelay(10*time.Millisecond), WithHedgeBudget(1))
+		_, err := timed(hedging)
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	It("should take a not found as an answer", func() {
+		laggy := &fakeClient{behave: func(call int64, _ int) (time.Duration, error) {
+			if call == 1 {
+				return 50 * time.Millisecond, ErrAccountNotFound
+			}
+			return time.Second, nil
+		}}
+		hedging := NewHedgingClient(laggy, WithHedgeDelay(10*time.Millisecond), WithHedgeBudget(1))
+		took, err := timed(hedging)
+		Ω(IsNotFound(err)).Should(BeTrue())
+		Ω(took).Should(BeNumerically("<", 500*time.Millisecond))
+	})
+})
@@ -0,0 +1,200 @@
+package account
+
+import (
+	"context"
+	"expvar"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/semaphore"
+)
+
+const (
+	// limiterBackoff is how much the adaptive limit shrinks by when the
+	// server struggles
+	limiterBackoff = 0.75
+	// limiterTolerance is how much slower than usual lookups can get before
+	// the server counts as struggling
+	limiterTolerance = 2.0
+	// limiterWindow is how many lookups the lowest latency is kept for
+	limiterWindow = 1000
+	// limiterFloor is the lowest baseline, so that jitter on lookups that
+	// barely take any time doesn't look like the server slowing down
+	limiterFloor = float64(time.Millisecond)
+)
+
+// limiterMetrics is published under account_limiter in expvar
+var limiterMetrics = expvar.NewMap("account_limiter")
+
+// WithAdaptiveConcurrency returns a WPStreamerOption that adjusts the number of
+// concurrent requests between min and max as the run goes, instead of sticking
+// to WithMaxConcurrentRequests, which becomes the starting point.  The limit
+// creeps up while lookups are quick and drops when they fail or get much slower
+// than usual.
+func WithAdaptiveConcurrency(min, max int64) WPStreamerOption {
+	if min <= 0 || max < min {
+		panic("adaptive concurrency needs 0 < min <= max")
+	}
+	return func(s *WPStreamer) {
+		s.adaptiveMin, s.adaptiveMax = min, max
+	}
+}
+
+// limiter decides how many lookups can be in flight.  release is told how the
+// lookup went, so the limit can follow the server.
+type limiter interface {
+	acquire(ctx context.Context) error
+	release(elapsed time.Duration, err error)
+}
+
+// fixedLimiter always allows the same number of lookups
+type fixedLimiter struct {
+	sem *semaphore.Weighted
+}
+
+func newFixedLimiter(n int64) *fixedLimiter {
+	return &fixedLimiter{sem: semaphore.NewWeighted(n)}
+}
+
+func (l *fixedLimiter) acquire(ctx context.Context) error {
+	return l.sem.Acquire(ctx, 1)
+}
+
+func (l *fixedLimiter) release(time.Duration, error) {
+	l.sem.Release(1)
+}
+
+// adaptiveLimiter adjusts the limit with additive increase, multiplicative
+// decrease.  Every lookup that goes well while the limit is in use adds about
+// 1/limit, so the limit grows by one each round trip.  A server failure, or
+// lookups getting much slower than the quickest recent ones, cut it by a
+// quarter, at most once per round trip so that one bad moment doesn't count
+// over and over.
+type adaptiveLimiter struct {
+	min, max float64
+
+	mu       sync.Mutex
+	limit    float64
+	inflight int
+	waiters  []chan struct{}
+
+	// short is a moving average of the latency.  It is compared to the
+	// lowest latency over this window and the last one, so the baseline
+	// can follow a server that gets slower for good.
+	short          float64
+	lowest, window float64
+	samples        int
+	lastDecrease   time.Time
+}
+
+func newAdaptiveLimiter(initial, min, max int64) *adaptiveLimiter {
+	l := &adaptiveLimiter{
+		min:   float64(min),
+		max:   float64(max),
+		limit: math.Max(float64(min), math.Min(float64(max), float64(initial))),
+	}
+	l.publish()
+	return l
+}
+
+func (l *adaptiveLimiter) acquire(ctx context.Context) error {
+	l.mu.Lock()
+	if l.inflight < int(l.limit) && len(l.waiters) == 0 {
+		l.inflight++
+		l.mu.Unlock()
+		return nil
+	}
+	ready := make(chan struct{})
+	l.waiters = append(l.waiters, ready)
+	l.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for i, w := range l.waiters {
+			if w == ready {
+				l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+				return ctx.Err()
+			}
+		}
+		// the slot was handed over just as we gave up, so pass it on
+		l.inflight--
+		l.wake()
+		return ctx.Err()
+	}
+}
+
+func (l *adaptiveLimiter) release(elapsed time.Duration, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	saturated := l.inflight >= int(l.limit)
+	l.inflight--
+
+	switch {
+	case errors.Cause(err) == context.Canceled:
+		// we gave up, which says nothing about the server
+	case isServerFailure(err):
+		l.decrease("failure")
+	default:
+		if l.observe(float64(elapsed)) {
+			l.decrease("latency")
+		} else if saturated {
+			l.limit = math.Min(l.max, l.limit+1/l.limit)
+			l.publish()
+		}
+	}
+	l.wake()
+}
+
+// observe records the latency of a lookup, returning true if lookups have
+// become much slower than the baseline.  l.mu must be held.
+func (l *adaptiveLimiter) observe(latency float64) bool {
+	if l.samples == 0 && l.lowest == 0 {
+		l.short, l.lowest, l.window = latency, latency, latency
+	}
+	l.short += 0.1 * (latency - l.short)
+	l.window = math.Min(l.window, latency)
+	if l.samples++; l.samples == limiterWindow {
+		l.lowest, l.samples = l.window, 0
+		l.window = math.Inf(1)
+	}
+	baseline := math.Max(limiterFloor, math.Min(l.lowest, l.window))
+	return l.short > limiterTolerance*baseline
+}
+
+// decrease backs off.  l.mu must be held.
+func (l *adaptiveLimiter) decrease(reason string) {
+	now := time.Now()
+	if now.Sub(l.lastDecrease) < time.Duration(l.short) {
+		return
+	}
+	l.lastDecrease = now
+	l.limit = math.Max(l.min, l.limit*limiterBackoff)
+	l.publish()
+	limiterMetrics.Add("decreases", 1)
+	logrus.WithField("limit", int(l.limit)).WithField("reason", reason).Debug("Reduced concurrent requests")
+}
+
+// wake hands free slots to the waiters, first come first served.  l.mu must be
+// held.
+func (l *adaptiveLimiter) wake() {
+	for len(l.waiters) > 0 && l.inflight < int(l.limit) {
+		l.inflight++
+		close(l.waiters[0])
+		l.waiters = l.waiters[1:]
+	}
+}
+
+// publish updates the limit in expvar.  l.mu must be held.
+func (l *adaptiveLimiter) publish() {
+	v := new(expvar.Int)
+	v.Set(int64(l.limit))
+	limiterMetrics.Set("limit", v)
+}
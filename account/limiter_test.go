@@ -0,0 +1,88 @@
+package account_test
+
+import (
+	"bytes"
+	"context"
+	"expvar"
+	"io/ioutil"
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/wpe_merge/wpe_merge/account"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func limiterMetric() int64 {
+	return expvar.Get("account_limiter").(*expvar.Map).Get("limit").(*expvar.Int).Value()
+}
+
+var _ = Describe("Adaptive concurrency", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	input := func(n int) *bytes.Buffer {
+		var buf bytes.Buffer
+		Ω(writeInput(&buf, n, 1)).Should(Succeed())
+		return &buf
+	}
+
+	It("should stick to the limit without it", func() {
+		client := &fakeClient{behave: func(int64, int) (time.Duration, error) { return time.Millisecond, nil }}
+		_, err := NewWPStreamer(client, WithMaxConcurrentRequests(3)).Run(ctx, input(200), ioutil.Discard)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(client.Peak()).Should(Equal(3))
+	})
+
+	It("should speed up on a healthy server", func() {
+		client := &fakeClient{behave: func(int64, int) (time.Duration, error) { return 2 * time.Millisecond, nil }}
+		streamer := NewWPStreamer(client,
+			WithMaxConcurrentRequests(2),
+			WithAdaptiveConcurrency(1, 20))
+		sum, err := streamer.Run(ctx, input(1000), ioutil.Discard)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(sum.Written).Should(BeEquivalentTo(1000))
+		Ω(client.Peak()).Should(BeNumerically(">", 2))
+		Ω(client.Peak()).Should(BeNumerically("<=", 20))
+	})
+
+	It("should back off when requests fail", func() {
+		client := &fakeClient{behave: func(int64, int) (time.Duration, error) {
+			return time.Millisecond, errors.New("connection refused")
+		}}
+		streamer := NewWPStreamer(client,
+			WithMaxConcurrentRequests(8),
+			WithAdaptiveConcurrency(1, 20))
+		sum, err := streamer.Run(ctx, input(100), ioutil.Discard)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(sum.Failed).Should(BeEquivalentTo(100))
+		Ω(limiterMetric()).Should(BeEquivalentTo(1))
+	})
+
+	It("should back off when requests slow down", func() {
+		// the server copes with 4 at a time and crawls past that
+		client := &fakeClient{behave: func(_ int64, inflight int) (time.Duration, error) {
+			if inflight > 4 {
+				return 20 * time.Millisecond, nil
+			}
+			return time.Millisecond, nil
+		}}
+		streamer := NewWPStreamer(client,
+			WithMaxConcurrentRequests(1),
+			WithAdaptiveConcurrency(1, 50))
+		_, err := streamer.Run(ctx, input(2000), ioutil.Discard)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(limiterMetric()).Should(BeNumerically("<", 20))
+	})
+})
@@ -0,0 +1,69 @@
+package account
+
+import (
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// ErrMemoryLimit is returned when a run would have to hold on to more than the
+// memory allowed by WithMaxMemory
+var ErrMemoryLimit = errors.New("memory limit exceeded")
+
+// seenIdSize is roughly what an account id costs in the map of ids we've seen,
+// on top of the id itself
+const seenIdSize = 48
+
+// WithMaxMemory returns a WPStreamerOption that caps the memory a run uses for
+// the things that grow with the input: the account ids it has seen, the rows
+// held back by keep-last and merge, and the rows waiting on the header when
+// every server field is included.  The run fails with ErrMemoryLimit rather
+// than going over.  The count is a rough estimate, and doesn't include the
+// fixed cost of the requests in flight.
+func WithMaxMemory(n int64) WPStreamerOption {
+	return func(s *WPStreamer) {
+		s.maxMemory = n
+	}
+}
+
+// budget keeps track of the memory held by a run.  A nil budget has no limit.
+type budget struct {
+	max  int64
+	used int64
+}
+
+func newBudget(max int64) *budget {
+	if max <= 0 {
+		return nil
+	}
+	return &budget{max: max}
+}
+
+// reserve accounts for n more bytes, failing if that goes over the limit
+func (b *budget) reserve(n int64) error {
+	if b == nil {
+		return nil
+	}
+	if used := atomic.AddInt64(&b.used, n); used > b.max {
+		atomic.AddInt64(&b.used, -n)
+		return errors.Wrapf(ErrMemoryLimit, "need more than %d bytes", b.max)
+	}
+	return nil
+}
+
+// release gives back n bytes
+func (b *budget) release(n int64) {
+	if b == nil {
+		return
+	}
+	atomic.AddInt64(&b.used, -n)
+}
+
+// recordSize estimates the memory used by a row of values
+func recordSize(record []string) int64 {
+	n := int64(24 + 16*len(record))
+	for _, value := range record {
+		n += int64(len(value))
+	}
+	return n
+}
@@ -0,0 +1,161 @@
+package account_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"io"
+	"io/ioutil"
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/wpe_merge/wpe_merge/account"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// flushCounter is a RecordWriter that counts the rows and flushes
+type flushCounter struct {
+	rows, flushes int
+}
+
+func (w *flushCounter) Write(record []string) error {
+	w.rows++
+	return nil
+}
+
+func (w *flushCounter) Flush() {
+	w.flushes++
+}
+
+func (w *flushCounter) Error() error {
+	return nil
+}
+
+// syntheticInput generates n rows without holding them in memory.  The account
+// ids cycle through distinct values.
+func syntheticInput(n, distinct int) io.Reader {
+	r, w := io.Pipe()
+	go func() {
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"Account ID", "Account Name", "First Name", "Created On"})
+		for i := 0; i < n; i++ {
+			id := strconv.Itoa(i%distinct + 1)
+			cw.Write([]string{id, "user" + id, "Jane", "2020-01-01"})
+		}
+		cw.Flush()
+		w.CloseWithError(cw.Error())
+	}()
+	return r
+}
+
+var _ = Describe("Memory", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should flush the output every n rows", func() {
+		w := &flushCounter{}
+		streamer := NewWPStreamer(stubClient{}, WithFlushEvery(10))
+		_, err := streamer.RunRecords(ctx, syntheticInput(100, 100), w)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(w.rows).Should(Equal(101))
+		// once every ten rows, then once more at the end
+		Ω(w.flushes).Should(Equal(11))
+	})
+
+	It("should flush the output on a timer", func() {
+		w := &flushCounter{}
+		streamer := NewWPStreamer(&fakeClient{behave: func(int64, int) (time.Duration, error) { return 20 * time.Millisecond, nil }},
+			WithMaxConcurrentRequests(1),
+			WithFlushInterval(5*time.Millisecond))
+		_, err := streamer.RunRecords(ctx, syntheticInput(5, 5), w)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(w.flushes).Should(BeNumerically(">", 1))
+	})
+
+	It("should fail rather than hold back more rows than the limit allows", func() {
+		streamer := NewWPStreamer(stubClient{},
+			WithDedupePolicy(DedupeKeepLast),
+			WithMaxMemory(10*1024))
+		_, err := streamer.Run(ctx, syntheticInput(1000, 1000), ioutil.Discard)
+		Ω(errors.Cause(err)).Should(Equal(ErrMemoryLimit))
+	})
+
+	It("should fail rather than track more account ids than the limit allows", func() {
+		streamer := NewWPStreamer(stubClient{}, WithMaxMemory(10*1024))
+		_, err := streamer.Run(ctx, syntheticInput(1000, 1000), ioutil.Discard)
+		Ω(errors.Cause(err)).Should(Equal(ErrMemoryLimit))
+	})
+
+	It("should stay within the limit", func() {
+		streamer := NewWPStreamer(stubClient{},
+			WithDedupePolicy(DedupeMerge),
+			WithMaxMemory(1024*1024))
+		var w bytes.Buffer
+		sum, err := streamer.Run(ctx, syntheticInput(1000, 100), &w)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(sum.Written).Should(BeEquivalentTo(100))
+	})
+
+	It("should stream millions of rows in fixed memory", func() {
+		if testing.Short() {
+			Skip("streams millions of rows")
+		}
+
+		const maxHeap = 64 * 1024 * 1024
+
+		// keep an eye on the heap while the rows go by
+		var (
+			wg   sync.WaitGroup
+			peak uint64
+			done = make(chan struct{})
+		)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var stats runtime.MemStats
+			ticker := time.NewTicker(10 * time.Millisecond)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					runtime.ReadMemStats(&stats)
+					if stats.HeapAlloc > peak {
+						peak = stats.HeapAlloc
+					}
+				}
+			}
+		}()
+
+		// the account ids seen so far still grow with the input, but they
+		// count against the limit
+		streamer := NewWPStreamer(stubClient{},
+			WithFlushEvery(10000),
+			WithMaxMemory(16*1024*1024))
+		sum, err := streamer.Run(ctx, syntheticInput(2000000, 10000), ioutil.Discard)
+		close(done)
+		wg.Wait()
+
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(sum.Written).Should(BeEquivalentTo(2000000))
+		Ω(sum.Duplicates).Should(BeEquivalentTo(2000000 - 10000))
+		Ω(peak).Should(BeNumerically("<", maxHeap))
+	})
+})
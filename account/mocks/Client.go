@@ -56,3 +56,26 @@ func (_m *Client) GetAccounts(_a0 context.Context, _a1 *account.GetAccountsReque
 
 	return r0, r1
 }
+
+// GetAccountsByIDs provides a mock function with given fields: _a0, _a1
+func (_m *Client) GetAccountsByIDs(_a0 context.Context, _a1 []string) (*account.GetAccountsResponse, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 *account.GetAccountsResponse
+	if rf, ok := ret.Get(0).(func(context.Context, []string) *account.GetAccountsResponse); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*account.GetAccountsResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, []string) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
@@ -0,0 +1,198 @@
+package account
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// output is the last stage of a stream.  It turns merged records into rows,
+// applies the dedupe policy and takes care of the header, which can't always
+// be written up front: when every server field is included, we don't know the
+// columns until the first account comes back from the server.
+type output struct {
+	s      *WPStreamer
+	w      *syncWriter
+	sum    *Summary
+	buffer *dedupeBuffer
+	mem    *budget
+
+	mu           sync.Mutex
+	opened       bool
+	serverFields []string
+	pending      []outputRow
+	dropped      sync.Map
+}
+
+// outputRow is a record on its way to the output
+type outputRow struct {
+	accountId string
+	index     int64
+	record    *Record
+	columns   []string
+}
+
+func newOutput(s *WPStreamer, w *syncWriter, sum *Summary) *output {
+	o := &output{s: s, w: w, sum: sum, mem: newBudget(s.maxMemory)}
+	if s.dedupe == DedupeKeepLast || s.dedupe == DedupeMerge {
+		o.buffer = newDedupeBuffer(s.dedupe, o.mem)
+	}
+	return o
+}
+
+// open writes the header, unless it has to wait for the server fields
+func (o *output) open() error {
+	if o.s.allServerFields {
+		return nil
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.writeHeader(nil)
+}
+
+// write sends the row to the output, or holds on to it until the header is
+// known
+func (o *output) write(row outputRow) error {
+	o.mu.Lock()
+	if !o.opened {
+		if !row.record.Found() {
+			defer o.mu.Unlock()
+			if err := o.mem.reserve(row.size()); err != nil {
+				return err
+			}
+			o.pending = append(o.pending, row)
+			return nil
+		}
+		keys, err := row.record.Account.FlattenedKeys()
+		if err != nil {
+			o.mu.Unlock()
+			return errors.Wrap(err, "could not read server fields")
+		}
+		if err := o.writeHeader(keys); err != nil {
+			o.mu.Unlock()
+			return err
+		}
+	}
+	pending := o.pending
+	o.pending = nil
+	o.mu.Unlock()
+
+	for _, p := range pending {
+		o.mem.release(p.size())
+		if err := o.emit(p); err != nil {
+			return err
+		}
+	}
+	return o.emit(row)
+}
+
+// close writes anything that was held back and flushes the writer
+func (o *output) close() error {
+	o.mu.Lock()
+	if !o.opened {
+		// none of the accounts were found, so there are no server fields
+		if err := o.writeHeader(nil); err != nil {
+			o.mu.Unlock()
+			return err
+		}
+	}
+	pending := o.pending
+	o.pending = nil
+	o.mu.Unlock()
+
+	for _, p := range pending {
+		o.mem.release(p.size())
+		if err := o.emit(p); err != nil {
+			return err
+		}
+	}
+
+	// write the rows that survived deduplication
+	if o.buffer != nil {
+		for _, values := range o.buffer.records() {
+			if err := o.w.Write(values); err != nil {
+				return errors.Wrap(err, "could not write row")
+			}
+			atomic.AddInt64(&o.sum.Written, 1)
+		}
+	}
+
+	// flush the write buffer and make sure everything is a-ok
+	if err := o.w.Flush(); err != nil {
+		return errors.Wrap(err, "could not flush to writer")
+	}
+	return nil
+}
+
+// writeHeader must be called with the lock held
+func (o *output) writeHeader(serverFields []string) error {
+	o.opened = true
+	o.serverFields = serverFields
+	if err := o.w.Write(o.s.header(serverFields)); err != nil {
+		// Errors won't typically show up here because the csv writer buffers
+		// the data until it is flushed, which happens at the end of the run
+		// or every so often with WithFlushEvery and WithFlushInterval
+		return errors.Wrap(err, "could not write header")
+	}
+	return nil
+}
+
+func (o *output) emit(row outputRow) error {
+	values := append(row.record.Values(), row.columns...)
+	if len(o.serverFields) > 0 {
+		values = append(values, o.serverValues(row.record)...)
+	}
+
+	if o.buffer != nil {
+		return o.buffer.add(row.accountId, row.index, values)
+	}
+
+	// dump the output
+	if err := o.w.Write(values); err != nil {
+		// Again, errors don't usually appear here since the real magic
+		// doesn't happen until the writer is flushed
+		return errors.Wrap(err, "could not write row")
+	}
+	written := atomic.AddInt64(&o.sum.Written, 1)
+
+	// Flushing every so often keeps the output moving and turns up write
+	// errors while the run is still going
+	if n := o.s.flushRows; n > 0 && written%n == 0 {
+		if err := o.w.Flush(); err != nil {
+			return errors.Wrap(err, "could not flush to writer")
+		}
+	}
+	return nil
+}
+
+// size estimates the memory used by a row that is held back
+func (row outputRow) size() int64 {
+	return recordSize(row.record.Values()) + recordSize(row.columns)
+}
+
+// serverValues returns the flattened server fields in header order.  Fields
+// that weren't in the first account have no column, so they are dropped with a
+// warning.
+func (o *output) serverValues(record *Record) []string {
+	values := make([]string, len(o.serverFields))
+	if !record.Found() {
+		return values
+	}
+	flat, err := record.Account.Flatten()
+	if err != nil {
+		logrus.WithError(err).WithField("account_id", record.AccountId).Error("Could not read server fields")
+		return values
+	}
+	for i, key := range o.serverFields {
+		values[i] = flat[key]
+		delete(flat, key)
+	}
+	for key := range flat {
+		if _, warned := o.dropped.LoadOrStore(key, true); !warned {
+			logrus.WithField("field", key).Warn("Dropping server field that is missing from the header")
+		}
+	}
+	return values
+}
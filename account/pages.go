@@ -0,0 +1,39 @@
+package account
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// ListAccounts walks every page of accounts on the server, handing each page to
+// fn as it arrives.  A pageSize of 0 leaves the page size to the server.
+func ListAccounts(ctx context.Context, client Client, pageSize int, fn func([]*Account) error) error {
+	req := &GetAccountsRequest{PageSize: pageSize}
+	for page := 1; ; page++ {
+		resp, err := client.GetAccounts(ctx, req)
+		if err != nil {
+			return errors.Wrapf(err, "could not get page %d", page)
+		}
+		if err := fn(resp.Results); err != nil {
+			return err
+		}
+		if resp.Next == "" || len(resp.Results) == 0 {
+			return nil
+		}
+		req = &GetAccountsRequest{Page: page + 1, PageSize: pageSize}
+	}
+}
+
+// AllAccounts gets every page of accounts on the server
+func AllAccounts(ctx context.Context, client Client, pageSize int) ([]*Account, error) {
+	var accts []*Account
+	err := ListAccounts(ctx, client, pageSize, func(page []*Account) error {
+		accts = append(accts, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return accts, nil
+}
@@ -0,0 +1,263 @@
+package account
+
+import (
+	"bufio"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/xitongsys/parquet-go/marshal"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// DefaultRowGroupSize is roughly how many bytes of rows a ParquetWriter puts in
+// each row group unless told otherwise
+const DefaultRowGroupSize = 128 * 1024 * 1024
+
+// ParquetCompression is the codec the columns of a parquet file are compressed
+// with
+type ParquetCompression string
+
+const (
+	ParquetSnappy       ParquetCompression = "snappy"
+	ParquetZstd         ParquetCompression = "zstd"
+	ParquetGzip         ParquetCompression = "gzip"
+	ParquetUncompressed ParquetCompression = "none"
+)
+
+var parquetCodecs = map[ParquetCompression]parquet.CompressionCodec{
+	ParquetSnappy:       parquet.CompressionCodec_SNAPPY,
+	ParquetZstd:         parquet.CompressionCodec_ZSTD,
+	ParquetGzip:         parquet.CompressionCodec_GZIP,
+	ParquetUncompressed: parquet.CompressionCodec_UNCOMPRESSED,
+}
+
+// ParseParquetCompression validates the name of a compression codec
+func ParseParquetCompression(name string) (ParquetCompression, error) {
+	if _, ok := parquetCodecs[ParquetCompression(name)]; !ok {
+		return "", errors.Errorf("unknown parquet compression `%s`", name)
+	}
+	return ParquetCompression(name), nil
+}
+
+// ParquetOption is an option that can be passed into NewParquetWriter
+type ParquetOption func(w *ParquetWriter)
+
+// WithParquetCompression returns a ParquetOption that compresses the columns
+// with the codec instead of snappy
+func WithParquetCompression(compression ParquetCompression) ParquetOption {
+	return func(w *ParquetWriter) {
+		w.codec = parquetCodecs[compression]
+	}
+}
+
+// WithParquetColumnTypes returns a ParquetOption that gives the columns named
+// in types their own type instead of a string.  See ColumnTypes.
+func WithParquetColumnTypes(types map[string]ColumnType) ParquetOption {
+	return func(w *ParquetWriter) {
+		w.types = types
+	}
+}
+
+// WithRowGroupSize returns a ParquetOption that starts a new row group once
+// the rows in the current one take up about this many bytes.  Smaller row
+// groups need less memory to write and read, bigger ones compress better.
+func WithRowGroupSize(bytes int64) ParquetOption {
+	if bytes <= 0 {
+		panic("row group size must be positive")
+	}
+	return func(w *ParquetWriter) {
+		w.rowGroupSize = bytes
+	}
+}
+
+// ParquetWriter is a RecordWriter that writes the output as a parquet file.
+// The schema comes from the header, with the same column names as the
+// SQLiteWriter: the account id is an INT64, the Created On and Status Set On
+// dates are DATEs, columns typed by WithParquetColumnTypes are INT64, DOUBLE,
+// BOOLEAN or DATE, and everything else is a UTF8 string.  Every column is
+// optional, and empty fields are null.
+//
+// The rows are held in memory until a row group is full, so nothing is readable
+// until the writer is closed.
+type ParquetWriter struct {
+	codec        parquet.CompressionCodec
+	rowGroupSize int64
+	types        map[string]ColumnType
+
+	file    *os.File
+	buf     *bufio.Writer
+	pw      *writer.ParquetWriter
+	columns []typedColumn
+	err     error
+}
+
+var _ RecordWriter = &ParquetWriter{}
+
+// NewParquetWriter creates the parquet file at path
+func NewParquetWriter(path string, ops ...ParquetOption) (*ParquetWriter, error) {
+	w := &ParquetWriter{codec: parquet.CompressionCodec_SNAPPY, rowGroupSize: DefaultRowGroupSize}
+	for _, op := range ops {
+		op(w)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not create file `%s`", path)
+	}
+	w.file = file
+	w.buf = bufio.NewWriterSize(file, 64*1024)
+	return w, nil
+}
+
+// Write adds a row.  The first row is the header, which sets the schema.
+func (w *ParquetWriter) Write(record []string) error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.pw == nil {
+		w.err = w.open(record)
+		return w.err
+	}
+	if len(record) != len(w.columns) {
+		w.err = errors.Errorf("row has %d columns, expected %d", len(record), len(w.columns))
+		return w.err
+	}
+
+	values := make([]interface{}, len(record))
+	for i, field := range record {
+		if values[i], w.err = parquetValue(w.columns[i], field); w.err != nil {
+			return w.err
+		}
+	}
+	if err := w.pw.Write(values); err != nil {
+		w.err = errors.Wrap(err, "could not write row")
+	}
+	return w.err
+}
+
+// Flush does nothing.  Rows are written a row group at a time, and a parquet
+// file can't be read until its footer is written on Close.
+func (w *ParquetWriter) Flush() {}
+
+// Error returns the first error that happened while writing
+func (w *ParquetWriter) Error() error {
+	return w.err
+}
+
+// Close writes the last row group and the footer
+func (w *ParquetWriter) Close() error {
+	if w.err == nil && w.pw != nil {
+		if err := w.pw.WriteStop(); err != nil {
+			w.err = errors.Wrap(err, "could not finish parquet file")
+		}
+	}
+	if w.err == nil {
+		w.err = errors.Wrap(w.buf.Flush(), "could not write parquet file")
+	}
+	if err := w.file.Close(); w.err == nil && err != nil {
+		w.err = errors.Wrap(err, "could not write parquet file")
+	}
+	return w.err
+}
+
+// Remove deletes the file
+func (w *ParquetWriter) Remove() error {
+	w.file.Close()
+	return os.Remove(w.file.Name())
+}
+
+// open sets up the schema from the header
+func (w *ParquetWriter) open(header []string) error {
+	columns, err := typedColumns(header, w.types)
+	if err != nil {
+		return err
+	}
+
+	schema := make([]*parquet.SchemaElement, 0, len(columns)+1)
+	root := parquet.NewSchemaElement()
+	root.Name = "schema"
+	root.NumChildren = int32Ptr(int32(len(columns)))
+	root.RepetitionType = parquet.FieldRepetitionTypePtr(parquet.FieldRepetitionType_REQUIRED)
+	schema = append(schema, root)
+	for _, col := range columns {
+		schema = append(schema, parquetElement(col))
+	}
+
+	pw, err := writer.NewParquetWriterFromWriter(w.buf, schema, 1)
+	if err != nil {
+		return errors.Wrap(err, "could not start parquet file")
+	}
+	// rows are written as a list of values in column order, like csv
+	pw.MarshalFunc = marshal.MarshalCSV
+	pw.CompressionType = w.codec
+	pw.RowGroupSize = w.rowGroupSize
+
+	w.pw, w.columns = pw, columns
+	return nil
+}
+
+// parquetElement describes the column in the schema, with both the logical
+// type and the older converted type so that every reader understands it
+func parquetElement(col typedColumn) *parquet.SchemaElement {
+	el := parquet.NewSchemaElement()
+	el.Name = col.name
+	el.NumChildren = int32Ptr(0)
+	el.RepetitionType = parquet.FieldRepetitionTypePtr(parquet.FieldRepetitionType_OPTIONAL)
+	el.LogicalType = parquet.NewLogicalType()
+
+	switch col.typ {
+	case IntegerColumn:
+		el.Type = parquet.TypePtr(parquet.Type_INT64)
+		el.ConvertedType = parquet.ConvertedTypePtr(parquet.ConvertedType_INT_64)
+		el.LogicalType.INTEGER = &parquet.IntType{BitWidth: 64, IsSigned: true}
+	case NumberColumn:
+		// plain physical types have no logical type
+		el.Type = parquet.TypePtr(parquet.Type_DOUBLE)
+		el.LogicalType = nil
+	case BooleanColumn:
+		el.Type = parquet.TypePtr(parquet.Type_BOOLEAN)
+		el.LogicalType = nil
+	case DateColumn:
+		el.Type = parquet.TypePtr(parquet.Type_INT32)
+		el.ConvertedType = parquet.ConvertedTypePtr(parquet.ConvertedType_DATE)
+		el.LogicalType.DATE = parquet.NewDateType()
+	default:
+		el.Type = parquet.TypePtr(parquet.Type_BYTE_ARRAY)
+		el.ConvertedType = parquet.ConvertedTypePtr(parquet.ConvertedType_UTF8)
+		el.LogicalType.STRING = parquet.NewStringType()
+	}
+	return el
+}
+
+// parquetValue converts a field to the column's type.  Empty fields are null,
+// as are dates that can't be read, since there is nowhere to keep them as they
+// were.
+func parquetValue(col typedColumn, field string) (interface{}, error) {
+	switch {
+	case field == "":
+		return nil, nil
+	case col.typ == IntegerColumn:
+		return col.integer(field)
+	case col.typ == NumberColumn:
+		return col.number(field)
+	case col.typ == BooleanColumn:
+		return col.boolean(field)
+	case col.typ == DateColumn:
+		t, ok := col.date(field)
+		if !ok {
+			logrus.WithField("column", col.name).WithField("value", field).Warn("Could not read date, writing null")
+			return nil, nil
+		}
+		// dates are stored as days since the unix epoch
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return int32(day.Unix() / (24 * 60 * 60)), nil
+	}
+	return field, nil
+}
+
+func int32Ptr(n int32) *int32 {
+	return &n
+}
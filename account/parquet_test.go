@@ -0,0 +1,167 @@
+package account_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+
+	. "github.com/wpe_merge/wpe_merge/account"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ParquetWriter", func() {
+	var (
+		dir  string
+		path string
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "parquet")
+		Ω(err).ShouldNot(HaveOccurred())
+		path = filepath.Join(dir, "out.parquet")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	header := []string{"Account ID", "First Name", "Created On", "Status", "Status Set On"}
+
+	// write runs the records through a new writer and closes it
+	write := func(records [][]string, ops ...ParquetOption) {
+		w, err := NewParquetWriter(path, ops...)
+		Ω(err).ShouldNot(HaveOccurred())
+		for _, record := range records {
+			Ω(w.Write(record)).Should(Succeed())
+		}
+		Ω(w.Close()).Should(Succeed())
+	}
+
+	// read opens the file and returns the reader with every column
+	read := func() (*reader.ParquetReader, [][]interface{}) {
+		pf, err := local.NewLocalFileReader(path)
+		Ω(err).ShouldNot(HaveOccurred())
+		defer pf.Close()
+
+		pr, err := reader.NewParquetColumnReader(pf, 1)
+		Ω(err).ShouldNot(HaveOccurred())
+		var columns [][]interface{}
+		for i := int64(0); i < pr.SchemaHandler.GetColumnNum(); i++ {
+			values, _, _, err := pr.ReadColumnByIndex(i, pr.GetNumRows())
+			Ω(err).ShouldNot(HaveOccurred())
+			columns = append(columns, values)
+		}
+		pr.ReadStop()
+		return pr, columns
+	}
+
+	It("should write a typed schema", func() {
+		write([][]string{
+			append(header, "plan.name"),
+			{"007", "John", "01/12/2011", "good", "2011-01-12", "startup"},
+			{"2", "Bob", "1969-12-31", "", "", ""},
+		})
+
+		pr, columns := read()
+		Ω(pr.GetNumRows()).Should(BeEquivalentTo(2))
+
+		// the reader capitalizes the names it shows in the footer
+		var names []string
+		for _, info := range pr.SchemaHandler.Infos[1:] {
+			names = append(names, info.ExName)
+		}
+		Ω(names).Should(Equal([]string{"account_id", "first_name", "created_on", "status", "status_set_on", "plan_name"}))
+
+		schema := pr.Footer.Schema[1:]
+		Ω(schema[0].GetType()).Should(Equal(parquet.Type_INT64))
+		Ω(schema[0].GetLogicalType().INTEGER.BitWidth).Should(BeEquivalentTo(64))
+		Ω(schema[2].GetType()).Should(Equal(parquet.Type_INT32))
+		Ω(schema[2].GetConvertedType()).Should(Equal(parquet.ConvertedType_DATE))
+		Ω(schema[2].GetLogicalType().IsSetDATE()).Should(BeTrue())
+		Ω(schema[1].GetConvertedType()).Should(Equal(parquet.ConvertedType_UTF8))
+		Ω(schema[1].GetLogicalType().IsSetSTRING()).Should(BeTrue())
+
+		Ω(columns[0]).Should(Equal([]interface{}{int64(7), int64(2)}))
+		Ω(columns[1]).Should(Equal([]interface{}{"John", "Bob"}))
+		// days since 1970-01-01
+		Ω(columns[2]).Should(Equal([]interface{}{int32(14986), int32(-1)}))
+		Ω(columns[3]).Should(Equal([]interface{}{"good", nil}))
+		Ω(columns[4]).Should(Equal([]interface{}{int32(14986), nil}))
+		Ω(columns[5]).Should(Equal([]interface{}{"startup", nil}))
+	})
+
+	It("should type the columns it is told about", func() {
+		types := map[string]ColumnType{"Days": IntegerColumn, "Score": NumberColumn, "Changed": BooleanColumn, "Closed On": DateColumn}
+		write([][]string{
+			append(header, "Days", "Score", "Changed", "Closed On"),
+			{"1", "John", "", "good", "", "46", "2.5", "true", "1970-01-02"},
+			{"2", "Bob", "", "", "", "", "", "", ""},
+		}, WithParquetColumnTypes(types))
+
+		pr, columns := read()
+		schema := pr.Footer.Schema[1:]
+		Ω(schema[5].GetType()).Should(Equal(parquet.Type_INT64))
+		Ω(schema[6].GetType()).Should(Equal(parquet.Type_DOUBLE))
+		Ω(schema[7].GetType()).Should(Equal(parquet.Type_BOOLEAN))
+		Ω(schema[8].GetConvertedType()).Should(Equal(parquet.ConvertedType_DATE))
+
+		Ω(columns[5]).Should(Equal([]interface{}{int64(46), nil}))
+		Ω(columns[6]).Should(Equal([]interface{}{2.5, nil}))
+		Ω(columns[7]).Should(Equal([]interface{}{true, nil}))
+		Ω(columns[8]).Should(Equal([]interface{}{int32(1), nil}))
+	})
+
+	It("should compress with the codec", func() {
+		write([][]string{header, {"1", "John", "", "good", ""}}, WithParquetCompression(ParquetZstd))
+
+		pr, _ := read()
+		for _, chunk := range pr.Footer.RowGroups[0].Columns {
+			Ω(chunk.MetaData.Codec).Should(Equal(parquet.CompressionCodec_ZSTD))
+		}
+	})
+
+	It("should split the rows into row groups", func() {
+		records := [][]string{header}
+		for i := 1; i <= 5000; i++ {
+			records = append(records, []string{strconv.Itoa(i), "John", "2011-01-01", "good", "2011-01-01"})
+		}
+		write(records, WithRowGroupSize(1024))
+
+		pr, columns := read()
+		Ω(len(pr.Footer.RowGroups)).Should(BeNumerically(">", 1))
+		Ω(columns[0]).Should(HaveLen(5000))
+		Ω(columns[0][4999]).Should(Equal(int64(5000)))
+	})
+
+	It("should write null for dates it can't read", func() {
+		write([][]string{header, {"1", "John", "someday", "good", ""}})
+
+		_, columns := read()
+		Ω(columns[2]).Should(Equal([]interface{}{nil}))
+	})
+
+	It("should reject account ids that aren't numbers", func() {
+		w, err := NewParquetWriter(path)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(w.Write(header)).Should(Succeed())
+		Ω(w.Write([]string{"abc", "", "", "", ""})).Should(MatchError(ContainSubstring("not an integer")))
+
+		Ω(w.Remove()).Should(Succeed())
+		_, err = os.Stat(path)
+		Ω(os.IsNotExist(err)).Should(BeTrue())
+	})
+
+	It("should reject unknown codecs", func() {
+		_, err := ParseParquetCompression("lzma")
+		Ω(err).Should(HaveOccurred())
+		Ω(ParseParquetCompression("zstd")).Should(Equal(ParquetZstd))
+	})
+})
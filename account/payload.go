@@ -0,0 +1,171 @@
+package account
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// accountFields are the json keys that are decoded into the Account struct
+// rather than kept in Extra
+var accountFields = []string{"account_id", "status", "created_on"}
+
+// UnmarshalJSON decodes the known fields into the account and keeps everything
+// else in Extra, so that no part of the server response is lost
+func (a *Account) UnmarshalJSON(data []byte) error {
+	type plain Account
+	if err := json.Unmarshal(data, (*plain)(a)); err != nil {
+		return err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for _, key := range accountFields {
+		delete(fields, key)
+	}
+	a.Extra = nil
+	if len(fields) > 0 {
+		a.Extra = fields
+	}
+	return nil
+}
+
+// MarshalJSON encodes the account along with its extra fields
+func (a Account) MarshalJSON() ([]byte, error) {
+	type plain Account
+	data, err := json.Marshal(plain(a))
+	if err != nil || len(a.Extra) == 0 {
+		return data, err
+	}
+
+	fields := make(map[string]json.RawMessage, len(a.Extra)+len(accountFields))
+	for key, value := range a.Extra {
+		fields[key] = value
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return json.Marshal(fields)
+}
+
+// Field returns the value at a dot separated json path into the server
+// response, like "plan.name" or "domains.0".  Objects and arrays are returned
+// as json, and a missing value is an empty string.
+func (a *Account) Field(path string) (string, error) {
+	value, err := a.payload()
+	if err != nil {
+		return "", err
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			value = v[key]
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return "", nil
+			}
+			value = v[i]
+		default:
+			return "", nil
+		}
+	}
+	return formatValue(value)
+}
+
+// Flatten returns every extra field as a column, with nested objects and
+// arrays spelled out as dot separated paths (e.g. "plan.name").  The known
+// fields are left out since they already have columns of their own.
+func (a *Account) Flatten() (map[string]string, error) {
+	flat := make(map[string]string)
+	for key, raw := range a.Extra {
+		value, err := decodeValue(raw)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not decode `%s`", key)
+		}
+		if err := flatten(flat, key, value); err != nil {
+			return nil, err
+		}
+	}
+	return flat, nil
+}
+
+// FlattenedKeys returns the sorted keys from Flatten
+func (a *Account) FlattenedKeys() ([]string, error) {
+	flat, err := a.Flatten()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(flat))
+	for key := range flat {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// payload returns the whole server response as generic json values
+func (a *Account) payload() (interface{}, error) {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+	return decodeValue(data)
+}
+
+func flatten(flat map[string]string, prefix string, value interface{}) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if err := flatten(flat, prefix+"."+key, child); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for i, child := range v {
+			if err := flatten(flat, fmt.Sprintf("%s.%d", prefix, i), child); err != nil {
+				return err
+			}
+		}
+	default:
+		s, err := formatValue(v)
+		if err != nil {
+			return err
+		}
+		flat[prefix] = s
+	}
+	return nil
+}
+
+// decodeValue decodes json, keeping numbers as they were written
+func decodeValue(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func formatValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	data, err := json.Marshal(value)
+	return string(data), err
+}
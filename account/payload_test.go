@@ -0,0 +1,84 @@
+package account_test
+
+import (
+	"encoding/json"
+
+	. "github.com/wpe_merge/wpe_merge/account"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Account payload", func() {
+	const payload = `{
+		"account_id": 12,
+		"status": "good",
+		"created_on": "2020-01-01",
+		"plan": {"name": "growth", "seats": 5},
+		"domains": ["example.com", "example.org"],
+		"verified": true,
+		"deleted_on": null
+	}`
+
+	var acct *Account
+
+	BeforeEach(func() {
+		acct = &Account{}
+		Ω(json.Unmarshal([]byte(payload), acct)).Should(Succeed())
+	})
+
+	It("should decode the known fields", func() {
+		Ω(acct.AccountId).Should(Equal(12))
+		Ω(acct.Status).Should(Equal("good"))
+		Ω(acct.CreatedOn).Should(Equal("2020-01-01"))
+		Ω(acct.Extra).Should(HaveLen(4))
+		Ω(acct.Extra).ShouldNot(HaveKey("status"))
+	})
+
+	It("should leave Extra empty if there are no other fields", func() {
+		acct := &Account{}
+		Ω(json.Unmarshal([]byte(`{"account_id": 1, "status": "good"}`), acct)).Should(Succeed())
+		Ω(acct.Extra).Should(BeNil())
+	})
+
+	It("should encode the extra fields", func() {
+		data, err := json.Marshal(acct)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(data).Should(MatchJSON(payload))
+	})
+
+	DescribeTable("looking up fields by path",
+		func(path, expected string) {
+			Ω(acct.Field(path)).Should(Equal(expected))
+		},
+		Entry("a known field", "status", "good"),
+		Entry("a nested field", "plan.name", "growth"),
+		Entry("a number", "plan.seats", "5"),
+		Entry("an array element", "domains.1", "example.org"),
+		Entry("a boolean", "verified", "true"),
+		Entry("a null", "deleted_on", ""),
+		Entry("an object", "plan", `{"name":"growth","seats":5}`),
+		Entry("a missing field", "plan.price", ""),
+		Entry("an index out of range", "domains.7", ""),
+	)
+
+	It("should flatten the extra fields", func() {
+		Ω(acct.Flatten()).Should(Equal(map[string]string{
+			"plan.name":  "growth",
+			"plan.seats": "5",
+			"domains.0":  "example.com",
+			"domains.1":  "example.org",
+			"verified":   "true",
+			"deleted_on": "",
+		}))
+		Ω(acct.FlattenedKeys()).Should(Equal([]string{
+			"deleted_on",
+			"domains.0",
+			"domains.1",
+			"plan.name",
+			"plan.seats",
+			"verified",
+		}))
+	})
+})
@@ -0,0 +1,167 @@
+package account
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// MissingFromInput marks an account that exists on the server but is not
+	// listed in the input file
+	MissingFromInput = "input"
+	// MissingFromServer marks an account that is listed in the input file but
+	// does not exist on the server
+	MissingFromServer = "server"
+)
+
+var (
+	reconcileHeader = []string{
+		"Account ID",
+		"Missing From",
+		"First Name",
+		"Created On",
+		"Status",
+		"Status Set On",
+	}
+)
+
+// ReconcilerOption is an option that can be passed into the Reconciler
+type ReconcilerOption func(rc *Reconciler)
+
+// WithStatuses returns a ReconcilerOption that only reports server accounts
+// with one of the provided statuses.  No statuses means every account is
+// reported.
+func WithStatuses(statuses ...string) ReconcilerOption {
+	return func(rc *Reconciler) {
+		for _, status := range statuses {
+			rc.statuses[status] = true
+		}
+	}
+}
+
+// Reconciler audits an input file against the accounts on the server.  Unlike
+// the WPStreamer, which looks up the accounts we know about, the Reconciler
+// finds the accounts that each side is missing.
+type Reconciler struct {
+	client   Client
+	statuses map[string]bool
+}
+
+// NewReconciler instantiates a new Reconciler
+func NewReconciler(client Client, ops ...ReconcilerOption) *Reconciler {
+	rc := &Reconciler{
+		client:   client,
+		statuses: make(map[string]bool),
+	}
+	for _, op := range ops {
+		op(rc)
+	}
+	return rc
+}
+
+// Reconcile writes the server accounts that are absent from the input, followed
+// by the input accounts that are absent from the server.
+func (rc *Reconciler) Reconcile(ctx context.Context, r io.Reader, w io.Writer) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = len(inHeader)
+
+	// read the header line
+	record, err := cr.Read()
+	if err != nil {
+		return errors.Wrap(err, "could not read header")
+	}
+	if err := validateInHeader(record); err != nil {
+		return errors.Wrap(err, "could not read header")
+	}
+
+	// The whole input has to be read before we can tell which server accounts
+	// are missing from it.  Only the records are kept, so memory grows with
+	// the size of the input, but that is no worse than the server response.
+	var (
+		records []InRecord
+		inputs  = make(map[string]bool)
+	)
+	for {
+		raw, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return errors.Wrap(err, "could not read row")
+		}
+		inRecord := InRecord(raw)
+		records = append(records, inRecord)
+		inputs[normalizeAccountId(inRecord.AccountId())] = true
+	}
+
+	accts, err := AllAccounts(ctx, rc.client, 0)
+	if err != nil {
+		return errors.Wrap(err, "could not look up accounts")
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(reconcileHeader); err != nil {
+		return errors.Wrap(err, "could not write header")
+	}
+
+	// accounts on the server that the input doesn't cover
+	servers := make(map[string]bool, len(accts))
+	for _, acct := range accts {
+		accountId := strconv.Itoa(acct.AccountId)
+		servers[accountId] = true
+		if inputs[accountId] || !rc.matchStatus(acct.Status) {
+			continue
+		}
+		if err := cw.Write([]string{
+			accountId,
+			MissingFromInput,
+			"",
+			"",
+			acct.Status,
+			acct.CreatedOn,
+		}); err != nil {
+			return errors.Wrap(err, "could not write row")
+		}
+	}
+
+	// accounts in the input that the server doesn't know about
+	for _, inRecord := range records {
+		if servers[normalizeAccountId(inRecord.AccountId())] {
+			continue
+		}
+		if err := cw.Write([]string{
+			inRecord.AccountId(),
+			MissingFromServer,
+			inRecord.FirstName(),
+			inRecord.CreatedOn(),
+			"",
+			"",
+		}); err != nil {
+			return errors.Wrap(err, "could not write row")
+		}
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return errors.Wrap(err, "could not flush to writer")
+	}
+	return nil
+}
+
+func (rc *Reconciler) matchStatus(status string) bool {
+	return len(rc.statuses) == 0 || rc.statuses[status]
+}
+
+// normalizeAccountId makes input ids like "007" comparable with the integer ids
+// returned by the server.  Ids that aren't numbers are returned as-is, so they
+// never match a server account.
+func normalizeAccountId(accountId string) string {
+	n, err := strconv.Atoi(accountId)
+	if err != nil {
+		return accountId
+	}
+	return strconv.Itoa(n)
+}
@@ -0,0 +1,128 @@
+package account_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	. "github.com/wpe_merge/wpe_merge/account"
+	"github.com/wpe_merge/wpe_merge/account/mocks"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Reconciler", func() {
+	var (
+		T = GinkgoT()
+
+		ctx    context.Context
+		cancel context.CancelFunc
+		client *mocks.Client
+
+		mockCtx = mock.AnythingOfType("*context.cancelCtx")
+	)
+
+	BeforeEach(func() {
+		client = &mocks.Client{}
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+		client.AssertExpectations(T)
+	})
+
+	getReader := func(records [][]string) io.Reader {
+		var dummy bytes.Buffer
+		err := csv.NewWriter(&dummy).WriteAll(records)
+		Ω(err).ShouldNot(HaveOccurred())
+		return bytes.NewReader(dummy.Bytes())
+	}
+
+	assertWriter := func(actual []byte, expected [][]string) {
+		cr := csv.NewReader(bytes.NewReader(actual))
+
+		header, err := cr.Read()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(header).Should(Equal([]string{
+			"Account ID",
+			"Missing From",
+			"First Name",
+			"Created On",
+			"Status",
+			"Status Set On",
+		}))
+
+		records, err := cr.ReadAll()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(records).Should(ConsistOf(expected))
+	}
+
+	input := [][]string{
+		{"Account ID", "Account Name", "First Name", "Created On"},
+		{"1", "jdoe", "Jane", "2020-01-01"},
+		{"002", "bdole", "Bob", "2020-02-02"},
+		{"5", "gknight", "Gladys", "2020-03-03"},
+	}
+
+	accounts := &GetAccountsResponse{
+		Results: []*Account{
+			{AccountId: 1, Status: "good", CreatedOn: "2019-12-12"},
+			{AccountId: 2, Status: "closed", CreatedOn: "2019-11-11"},
+			{AccountId: 3, Status: "closed", CreatedOn: "2019-10-10"},
+			{AccountId: 4, Status: "good", CreatedOn: "2019-09-09"},
+		},
+	}
+
+	It("should return an error if the reader is missing a header", func() {
+		reconciler := NewReconciler(client)
+
+		w := &bytes.Buffer{}
+		err := reconciler.Reconcile(ctx, getReader(input[1:]), w)
+		Ω(errors.Cause(err)).Should(Equal(ErrInvalidHeader))
+		Ω(w.Len()).Should(BeZero())
+	})
+
+	It("should return an error if the server returns an error", func() {
+		client.On("GetAccounts", mockCtx, &GetAccountsRequest{}).Return(nil, errors.New("error"))
+		reconciler := NewReconciler(client)
+
+		w := &bytes.Buffer{}
+		err := reconciler.Reconcile(ctx, getReader(input), w)
+		Ω(err).Should(HaveOccurred())
+		Ω(w.Len()).Should(BeZero())
+	})
+
+	It("should report the accounts missing from either side", func() {
+		client.On("GetAccounts", mockCtx, &GetAccountsRequest{}).Return(accounts, nil)
+		reconciler := NewReconciler(client)
+
+		w := &bytes.Buffer{}
+		err := reconciler.Reconcile(ctx, getReader(input), w)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		assertWriter(w.Bytes(), [][]string{
+			{"3", "input", "", "", "closed", "2019-10-10"},
+			{"4", "input", "", "", "good", "2019-09-09"},
+			{"5", "server", "Gladys", "2020-03-03", "", ""},
+		})
+	})
+
+	It("should only report server accounts with a matching status", func() {
+		client.On("GetAccounts", mockCtx, &GetAccountsRequest{}).Return(accounts, nil)
+		reconciler := NewReconciler(client, WithStatuses("closed"))
+
+		w := &bytes.Buffer{}
+		err := reconciler.Reconcile(ctx, getReader(input), w)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		assertWriter(w.Bytes(), [][]string{
+			{"3", "input", "", "", "closed", "2019-10-10"},
+			{"5", "server", "Gladys", "2020-03-03", "", ""},
+		})
+	})
+})
@@ -0,0 +1,86 @@
+package account
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Record is an input row merged with the account data from the server.  The
+// fields hold what ends up in the output, so dates are already normalized by
+// the time the record is written.
+type Record struct {
+	AccountId   string
+	AccountName string
+	FirstName   string
+	CreatedOn   string
+	Status      string
+	StatusSetOn string
+
+	// Account is the response from the server, or nil if the account could
+	// not be looked up
+	Account *Account
+}
+
+// recordFields maps the names used in expressions to the record fields
+var recordFields = map[string]func(r *Record) string{
+	"account_id":    func(r *Record) string { return r.AccountId },
+	"account_name":  func(r *Record) string { return r.AccountName },
+	"first_name":    func(r *Record) string { return r.FirstName },
+	"created_on":    func(r *Record) string { return r.CreatedOn },
+	"status":        func(r *Record) string { return r.Status },
+	"status_set_on": func(r *Record) string { return r.StatusSetOn },
+}
+
+// NewRecord merges the input row with the account from the server, which may
+// be nil
+func NewRecord(in InRecord, acct *Account) *Record {
+	r := &Record{
+		AccountId:   in.AccountId(),
+		AccountName: in.AccountName(),
+		FirstName:   in.FirstName(),
+		CreatedOn:   in.CreatedOn(),
+		Account:     acct,
+	}
+	if acct != nil {
+		r.Status = acct.Status
+		r.StatusSetOn = acct.CreatedOn
+	}
+	return r
+}
+
+// Found returns true if the server knew about the account
+func (r *Record) Found() bool {
+	return r.Account != nil
+}
+
+// Field returns the value of a field by its snake case name (e.g.
+// "status_set_on")
+func (r *Record) Field(name string) (string, error) {
+	get, ok := recordFields[strings.ToLower(name)]
+	if !ok {
+		return "", errors.Errorf("unknown field `%s`", name)
+	}
+	return get(r), nil
+}
+
+// Server returns the value at a dot separated json path into the server
+// response (see Account.Field), or an empty string if the account wasn't found.
+// Column templates can use it as {{.Server "plan.name"}}.
+func (r *Record) Server(path string) (string, error) {
+	if r.Account == nil {
+		return "", nil
+	}
+	return r.Account.Field(path)
+}
+
+// Values returns the record in the order of the output header
+func (r *Record) Values() []string {
+	return []string{
+		r.AccountId,
+		r.FirstName,
+		r.CreatedOn,
+		r.Status,
+		r.StatusSetOn,
+	}
+}
@@ -0,0 +1,123 @@
+package account
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ColumnType is the type of the values in an output column, for the outputs
+// that store more than text
+type ColumnType string
+
+const (
+	TextColumn    ColumnType = "text"
+	IntegerColumn ColumnType = "integer"
+	NumberColumn  ColumnType = "number"
+	BooleanColumn ColumnType = "boolean"
+	DateColumn    ColumnType = "date"
+)
+
+var (
+	// standardColumnTypes are the standard output columns that aren't text
+	standardColumnTypes = map[string]ColumnType{
+		"Account ID":    IntegerColumn,
+		"Created On":    DateColumn,
+		"Status Set On": DateColumn,
+	}
+
+	nonWord = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// ParseColumnType validates the name of a column type
+func ParseColumnType(name string) (ColumnType, error) {
+	switch typ := ColumnType(name); typ {
+	case TextColumn, IntegerColumn, NumberColumn, BooleanColumn, DateColumn:
+		return typ, nil
+	}
+	return "", errors.Errorf("unknown column type `%s`, expected text, integer, number, boolean or date", name)
+}
+
+// ColumnTypes returns the types of the computed columns by name, for the
+// writers that need to know them
+func ColumnTypes(cols []*Column) map[string]ColumnType {
+	types := make(map[string]ColumnType, len(cols))
+	for _, col := range cols {
+		types[col.Name] = col.Type
+	}
+	return types
+}
+
+// typedColumn is an output column, named so that databases can use it
+type typedColumn struct {
+	name string
+	typ  ColumnType
+}
+
+// typedColumns works out the columns from the output header.  Names are in
+// snake case, so Status Set On becomes status_set_on and plan.name becomes
+// plan_name.  The standard columns have their own types, the others are
+// looked up in types, and anything else is text.
+func typedColumns(header []string, types map[string]ColumnType) ([]typedColumn, error) {
+	var (
+		columns = make([]typedColumn, 0, len(header))
+		seen    = make(map[string]string, len(header))
+	)
+	for _, h := range header {
+		col := typedColumn{
+			name: strings.Trim(nonWord.ReplaceAllString(strings.ToLower(h), "_"), "_"),
+			typ:  TextColumn,
+		}
+		if typ, ok := standardColumnTypes[h]; ok {
+			col.typ = typ
+		} else if typ, ok := types[h]; ok && typ != "" {
+			col.typ = typ
+		}
+		if col.name == "" {
+			return nil, errors.Errorf("column `%s` has no usable name", h)
+		}
+		if other, ok := seen[col.name]; ok {
+			return nil, errors.Errorf("columns `%s` and `%s` would both be stored as `%s`", other, h, col.name)
+		}
+		seen[col.name] = h
+		columns = append(columns, col)
+	}
+	return columns, nil
+}
+
+// integer reads the field of an integer column
+func (col typedColumn) integer(field string) (int64, error) {
+	n, err := strconv.ParseInt(strings.TrimSpace(field), 10, 64)
+	if err != nil {
+		return 0, errors.Errorf("%s `%s` is not an integer", col.name, field)
+	}
+	return n, nil
+}
+
+// number reads the field of a number column
+func (col typedColumn) number(field string) (float64, error) {
+	n, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+	if err != nil {
+		return 0, errors.Errorf("%s `%s` is not a number", col.name, field)
+	}
+	return n, nil
+}
+
+// boolean reads the field of a boolean column
+func (col typedColumn) boolean(field string) (bool, error) {
+	b, err := strconv.ParseBool(strings.TrimSpace(field))
+	if err != nil {
+		return false, errors.Errorf("%s `%s` is not true or false", col.name, field)
+	}
+	return b, nil
+}
+
+// date reads the field of a date column, returning false if it isn't a date we
+// know how to read
+func (col typedColumn) date(field string) (time.Time, bool) {
+	t, err := ParseDate(field, time.UTC)
+	return t, err == nil
+}
@@ -0,0 +1,236 @@
+package account
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ShardInfo describes one of the files written by a ShardWriter.  The file name
+// is relative to the manifest.
+type ShardInfo struct {
+	File   string `json:"file"`
+	Rows   int64  `json:"rows"`
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256"`
+}
+
+// ShardManifest lists the files written by a ShardWriter
+type ShardManifest struct {
+	CreatedAt time.Time    `json:"created_at"`
+	Header    []string     `json:"header"`
+	Rows      int64        `json:"rows"`
+	Shards    []*ShardInfo `json:"shards"`
+}
+
+// ShardWriter is a RecordWriter that splits the output across several csv
+// files, starting a new one every maxRows rows or once the file reaches
+// maxBytes.  For an output path of out.csv, the files are named out-0001.csv,
+// out-0002.csv and so on, each starting with the header, and a manifest is
+// written to out-manifest.json when the writer is closed.
+type ShardWriter struct {
+	prefix, ext       string
+	maxRows, maxBytes int64
+
+	header   []string
+	current  *shard
+	manifest ShardManifest
+	err      error
+}
+
+// shard is the file currently being written
+type shard struct {
+	info *ShardInfo
+	file *os.File
+	buf  *bufio.Writer
+	hash hash.Hash
+	cw   *csv.Writer
+}
+
+func (sh *shard) Write(p []byte) (int, error) {
+	n, err := sh.buf.Write(p)
+	sh.hash.Write(p[:n])
+	sh.info.Bytes += int64(n)
+	return n, err
+}
+
+var _ RecordWriter = &ShardWriter{}
+
+// NewShardWriter instantiates a new ShardWriter.  A limit of 0 means no limit.
+func NewShardWriter(path string, maxRows, maxBytes int64) *ShardWriter {
+	ext := filepath.Ext(path)
+	return &ShardWriter{
+		prefix:   strings.TrimSuffix(path, ext),
+		ext:      ext,
+		maxRows:  maxRows,
+		maxBytes: maxBytes,
+		manifest: ShardManifest{CreatedAt: time.Now().UTC()},
+	}
+}
+
+// Write writes a row, starting a new shard first if the current one is full.
+// The first row is the header.
+func (w *ShardWriter) Write(record []string) error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.header == nil {
+		w.header = append([]string{}, record...)
+		w.manifest.Header = w.header
+		return nil
+	}
+
+	if w.current == nil || w.full() {
+		if w.err = w.rotate(); w.err != nil {
+			return w.err
+		}
+	}
+
+	if w.err = w.current.cw.Write(record); w.err != nil {
+		return w.err
+	}
+	// Flushing the csv writer on every row pushes the row into our own buffer,
+	// which is what lets us keep an exact count of the bytes in the shard
+	w.current.cw.Flush()
+	if w.err = w.current.cw.Error(); w.err != nil {
+		return w.err
+	}
+	w.current.info.Rows++
+	w.manifest.Rows++
+	return nil
+}
+
+// Flush writes any buffered data to the current shard
+func (w *ShardWriter) Flush() {
+	if w.err != nil || w.current == nil {
+		return
+	}
+	w.err = w.current.buf.Flush()
+}
+
+// Error returns the first error that happened while writing
+func (w *ShardWriter) Error() error {
+	return w.err
+}
+
+// Close finishes the last shard and writes the manifest
+func (w *ShardWriter) Close() error {
+	if w.err != nil {
+		if w.current != nil {
+			w.current.file.Close()
+		}
+		return w.err
+	}
+
+	// an empty output still gets a shard with the header
+	if w.current == nil && w.header != nil {
+		if w.err = w.rotate(); w.err != nil {
+			return w.err
+		}
+	}
+	if w.current != nil {
+		if w.err = w.closeShard(); w.err != nil {
+			return w.err
+		}
+	}
+
+	data, err := json.MarshalIndent(&w.manifest, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "could not encode manifest")
+	}
+	if err := ioutil.WriteFile(w.ManifestPath(), data, 0644); err != nil {
+		return errors.Wrap(err, "could not write manifest")
+	}
+	return nil
+}
+
+// Remove deletes every shard and the manifest
+func (w *ShardWriter) Remove() error {
+	if w.current != nil {
+		w.current.file.Close()
+	}
+	var firstErr error
+	for _, info := range w.manifest.Shards {
+		if err := os.Remove(filepath.Join(filepath.Dir(w.prefix), info.File)); err != nil && !os.IsNotExist(err) && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if err := os.Remove(w.ManifestPath()); err != nil && !os.IsNotExist(err) && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
+
+// ManifestPath returns where the manifest is written
+func (w *ShardWriter) ManifestPath() string {
+	return w.prefix + "-manifest.json"
+}
+
+// Manifest returns the shards written so far
+func (w *ShardWriter) Manifest() *ShardManifest {
+	return &w.manifest
+}
+
+func (w *ShardWriter) full() bool {
+	info := w.current.info
+	return (w.maxRows > 0 && info.Rows >= w.maxRows) ||
+		(w.maxBytes > 0 && info.Bytes >= w.maxBytes)
+}
+
+// rotate closes the current shard and opens the next one
+func (w *ShardWriter) rotate() error {
+	if w.current != nil {
+		if err := w.closeShard(); err != nil {
+			return err
+		}
+	}
+
+	path := fmt.Sprintf("%s-%04d%s", w.prefix, len(w.manifest.Shards)+1, w.ext)
+	file, err := os.Create(path)
+	if err != nil {
+		return errors.Wrapf(err, "could not create shard `%s`", path)
+	}
+	sh := &shard{
+		info: &ShardInfo{File: filepath.Base(path)},
+		file: file,
+		buf:  bufio.NewWriterSize(file, 64*1024),
+		hash: sha256.New(),
+	}
+	sh.cw = csv.NewWriter(sh)
+	w.manifest.Shards = append(w.manifest.Shards, sh.info)
+	w.current = sh
+
+	if err := sh.cw.Write(w.header); err != nil {
+		return errors.Wrap(err, "could not write header")
+	}
+	sh.cw.Flush()
+	return sh.cw.Error()
+}
+
+func (w *ShardWriter) closeShard() error {
+	sh := w.current
+	w.current = nil
+
+	sh.cw.Flush()
+	if err := sh.cw.Error(); err != nil {
+		sh.file.Close()
+		return err
+	}
+	if err := sh.buf.Flush(); err != nil {
+		sh.file.Close()
+		return err
+	}
+	sh.info.SHA256 = hex.EncodeToString(sh.hash.Sum(nil))
+	return sh.file.Close()
+}
@@ -0,0 +1,101 @@
+package account_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/wpe_merge/wpe_merge/account"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ShardWriter", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "shards")
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	writeRows := func(w *ShardWriter, n int) {
+		Ω(w.Write([]string{"Account ID", "First Name"})).Should(Succeed())
+		for i := 1; i <= n; i++ {
+			Ω(w.Write([]string{fmt.Sprintf("%d", i), "Jane"})).Should(Succeed())
+		}
+		w.Flush()
+		Ω(w.Error()).Should(Succeed())
+		Ω(w.Close()).Should(Succeed())
+	}
+
+	readManifest := func() *ShardManifest {
+		data, err := ioutil.ReadFile(filepath.Join(dir, "out-manifest.json"))
+		Ω(err).ShouldNot(HaveOccurred())
+		var manifest ShardManifest
+		Ω(json.Unmarshal(data, &manifest)).Should(Succeed())
+		return &manifest
+	}
+
+	It("should start a new shard every n rows", func() {
+		w := NewShardWriter(filepath.Join(dir, "out.csv"), 2, 0)
+		writeRows(w, 5)
+
+		manifest := readManifest()
+		Ω(manifest.Rows).Should(BeEquivalentTo(5))
+		Ω(manifest.Header).Should(Equal([]string{"Account ID", "First Name"}))
+		Ω(manifest.Shards).Should(HaveLen(3))
+
+		for i, rows := range []int64{2, 2, 1} {
+			info := manifest.Shards[i]
+			Ω(info.File).Should(Equal(fmt.Sprintf("out-%04d.csv", i+1)))
+			Ω(info.Rows).Should(Equal(rows))
+
+			data, err := ioutil.ReadFile(filepath.Join(dir, info.File))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(data).Should(HavePrefix("Account ID,First Name\n"))
+			Ω(info.Bytes).Should(BeEquivalentTo(len(data)))
+			sum := sha256.Sum256(data)
+			Ω(info.SHA256).Should(Equal(hex.EncodeToString(sum[:])))
+		}
+	})
+
+	It("should start a new shard once the file reaches n bytes", func() {
+		// the header is 22 bytes and each row is 7 bytes
+		w := NewShardWriter(filepath.Join(dir, "out.csv"), 0, 36)
+		writeRows(w, 5)
+
+		manifest := readManifest()
+		Ω(manifest.Shards).Should(HaveLen(3))
+		Ω(manifest.Shards[0].Rows).Should(BeEquivalentTo(2))
+		Ω(manifest.Shards[0].Bytes).Should(BeEquivalentTo(36))
+	})
+
+	It("should write a shard with just the header if there are no rows", func() {
+		w := NewShardWriter(filepath.Join(dir, "out.csv"), 2, 0)
+		writeRows(w, 0)
+
+		manifest := readManifest()
+		Ω(manifest.Shards).Should(HaveLen(1))
+		Ω(manifest.Shards[0].Rows).Should(BeZero())
+	})
+
+	It("should remove every shard", func() {
+		w := NewShardWriter(filepath.Join(dir, "out.csv"), 2, 0)
+		writeRows(w, 5)
+		Ω(w.Remove()).Should(Succeed())
+
+		files, err := ioutil.ReadDir(dir)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(files).Should(BeEmpty())
+	})
+})
@@ -0,0 +1,180 @@
+package account
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SnapshotVersion is the version of the snapshot format written by
+// WriteSnapshot
+const SnapshotVersion = 1
+
+// SnapshotMeta describes a snapshot.  It is the first line of the file.
+type SnapshotMeta struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	// Source is where the accounts came from, usually the server url
+	Source string `json:"source,omitempty"`
+}
+
+// WriteSnapshot copies every account from the client to w, a page at a time,
+// and returns how many were written.  The snapshot is a line of metadata
+// followed by an account per line, all as json.
+func WriteSnapshot(ctx context.Context, client Client, w io.Writer, source string, pageSize int) (int, error) {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	meta := &SnapshotMeta{
+		Version:   SnapshotVersion,
+		CreatedAt: time.Now().UTC(),
+		Source:    source,
+	}
+	if err := enc.Encode(meta); err != nil {
+		return 0, errors.Wrap(err, "could not write snapshot")
+	}
+
+	var n int
+	err := ListAccounts(ctx, client, pageSize, func(page []*Account) error {
+		for _, acct := range page {
+			if err := enc.Encode(acct); err != nil {
+				return errors.Wrap(err, "could not write snapshot")
+			}
+			n++
+		}
+		return nil
+	})
+	if err != nil {
+		return n, err
+	}
+	if err := bw.Flush(); err != nil {
+		return n, errors.Wrap(err, "could not write snapshot")
+	}
+	return n, nil
+}
+
+// SnapshotClient is a Client that answers from a snapshot instead of the
+// server, for runs that can't reach it or need to give the same answer every
+// time
+type SnapshotClient struct {
+	meta     SnapshotMeta
+	accounts map[string]*Account
+	// ids are the account ids in order, for paging
+	ids []int
+}
+
+var _ Client = &SnapshotClient{}
+
+// OpenSnapshot loads a snapshot file
+func OpenSnapshot(file string) (*SnapshotClient, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not open snapshot")
+	}
+	defer f.Close()
+	return LoadSnapshot(f)
+}
+
+// LoadSnapshot reads a snapshot written by WriteSnapshot.  It is held in memory
+// in full.
+func LoadSnapshot(r io.Reader) (*SnapshotClient, error) {
+	c := &SnapshotClient{accounts: make(map[string]*Account)}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16*1024*1024)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, errors.Wrap(err, "could not read snapshot")
+		}
+		return nil, errors.New("snapshot is empty")
+	}
+	if err := json.Unmarshal(scanner.Bytes(), &c.meta); err != nil {
+		return nil, errors.Wrap(err, "could not read snapshot metadata")
+	}
+	if c.meta.Version != SnapshotVersion {
+		return nil, errors.Errorf("unsupported snapshot version %d", c.meta.Version)
+	}
+
+	for line := 2; scanner.Scan(); line++ {
+		var acct Account
+		if err := json.Unmarshal(scanner.Bytes(), &acct); err != nil {
+			return nil, errors.Wrapf(err, "could not read snapshot line %d", line)
+		}
+		key := strconv.Itoa(acct.AccountId)
+		if _, ok := c.accounts[key]; !ok {
+			c.ids = append(c.ids, acct.AccountId)
+		}
+		c.accounts[key] = &acct
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "could not read snapshot")
+	}
+	sort.Ints(c.ids)
+	return c, nil
+}
+
+// Meta returns the snapshot's metadata
+func (c *SnapshotClient) Meta() SnapshotMeta {
+	return c.meta
+}
+
+// GetAccounts returns a page of the accounts in account id order.  Without a
+// page size, everything is in the first page.
+func (c *SnapshotClient) GetAccounts(ctx context.Context, req *GetAccountsRequest) (*GetAccountsResponse, error) {
+	page, pageSize := req.Page, req.PageSize
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = len(c.ids)
+	}
+	start := (page - 1) * pageSize
+	if start > len(c.ids) || (start == len(c.ids) && page > 1) {
+		return nil, ResponseError{Detail: "Invalid page.", StatusCode: http.StatusNotFound}
+	}
+	end := start + pageSize
+	if end > len(c.ids) {
+		end = len(c.ids)
+	}
+
+	resp := &GetAccountsResponse{
+		Count:   len(c.ids),
+		Results: make([]*Account, 0, end-start),
+	}
+	for _, id := range c.ids[start:end] {
+		resp.Results = append(resp.Results, c.accounts[strconv.Itoa(id)])
+	}
+	if end < len(c.ids) {
+		resp.Next = fmt.Sprintf("?page=%d&page_size=%d", page+1, pageSize)
+	}
+	if page > 1 {
+		resp.Previous = fmt.Sprintf("?page=%d&page_size=%d", page-1, pageSize)
+	}
+	return resp, nil
+}
+
+func (c *SnapshotClient) GetAccount(ctx context.Context, req *GetAccountRequest) (*Account, error) {
+	acct, ok := c.accounts[normalizeAccountId(req.AccountId)]
+	if !ok {
+		return nil, errors.Wrap(ErrAccountNotFound, "could not look up account")
+	}
+	return acct, nil
+}
+
+func (c *SnapshotClient) GetAccountsByIDs(ctx context.Context, ids []string) (*GetAccountsResponse, error) {
+	resp := &GetAccountsResponse{Results: make([]*Account, 0, len(ids))}
+	for _, id := range ids {
+		if acct, ok := c.accounts[normalizeAccountId(id)]; ok {
+			resp.Results = append(resp.Results, acct)
+		}
+	}
+	return resp, nil
+}
@@ -0,0 +1,130 @@
+package account
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// The kinds of change between two snapshots
+const (
+	// ChangeAdded is an account that is only in the newer snapshot
+	ChangeAdded = "added"
+	// ChangeRemoved is an account that is only in the older snapshot
+	ChangeRemoved = "removed"
+	// ChangeStatus is an account whose status changed between the snapshots
+	ChangeStatus = "status"
+)
+
+var (
+	snapshotDiffHeader = []string{
+		"Account ID",
+		"Change",
+		"Old Status",
+		"New Status",
+		"Status Set On",
+	}
+)
+
+// SnapshotChange is a difference in a single account between two snapshots.
+// Removed accounts have no new status, and added ones no old status.
+// StatusSetOn comes from the newer snapshot, so it is empty for removed
+// accounts.
+type SnapshotChange struct {
+	AccountId   int    `json:"account_id"`
+	Change      string `json:"change"`
+	OldStatus   string `json:"old_status,omitempty"`
+	NewStatus   string `json:"new_status,omitempty"`
+	StatusSetOn string `json:"status_set_on,omitempty"`
+}
+
+// SnapshotDiff is what changed between two snapshots, in account id order
+type SnapshotDiff struct {
+	Old     SnapshotMeta      `json:"old"`
+	New     SnapshotMeta      `json:"new"`
+	Changes []*SnapshotChange `json:"changes"`
+}
+
+// DiffSnapshots finds the accounts that were added, removed or changed status
+// between the old and new snapshots.  Accounts that are the same in both are
+// left out.
+func DiffSnapshots(old, new *SnapshotClient) *SnapshotDiff {
+	d := &SnapshotDiff{Old: old.meta, New: new.meta, Changes: []*SnapshotChange{}}
+
+	// both lists of ids are sorted, so walk them together
+	i, j := 0, 0
+	for i < len(old.ids) || j < len(new.ids) {
+		switch {
+		case j == len(new.ids) || (i < len(old.ids) && old.ids[i] < new.ids[j]):
+			before := old.accounts[strconv.Itoa(old.ids[i])]
+			d.Changes = append(d.Changes, &SnapshotChange{
+				AccountId: before.AccountId,
+				Change:    ChangeRemoved,
+				OldStatus: before.Status,
+			})
+			i++
+		case i == len(old.ids) || new.ids[j] < old.ids[i]:
+			after := new.accounts[strconv.Itoa(new.ids[j])]
+			d.Changes = append(d.Changes, &SnapshotChange{
+				AccountId:   after.AccountId,
+				Change:      ChangeAdded,
+				NewStatus:   after.Status,
+				StatusSetOn: after.CreatedOn,
+			})
+			j++
+		default:
+			key := strconv.Itoa(old.ids[i])
+			before, after := old.accounts[key], new.accounts[key]
+			if before.Status != after.Status {
+				d.Changes = append(d.Changes, &SnapshotChange{
+					AccountId:   after.AccountId,
+					Change:      ChangeStatus,
+					OldStatus:   before.Status,
+					NewStatus:   after.Status,
+					StatusSetOn: after.CreatedOn,
+				})
+			}
+			i++
+			j++
+		}
+	}
+	return d
+}
+
+// Count returns the number of changes of a kind
+func (d *SnapshotDiff) Count(change string) int {
+	var n int
+	for _, c := range d.Changes {
+		if c.Change == change {
+			n++
+		}
+	}
+	return n
+}
+
+// WriteCSV writes the changes as csv, one row per account
+func (d *SnapshotDiff) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(snapshotDiffHeader); err != nil {
+		return errors.Wrap(err, "could not write header")
+	}
+	for _, c := range d.Changes {
+		if err := cw.Write([]string{
+			strconv.Itoa(c.AccountId),
+			c.Change,
+			c.OldStatus,
+			c.NewStatus,
+			c.StatusSetOn,
+		}); err != nil {
+			return errors.Wrap(err, "could not write row")
+		}
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return errors.Wrap(err, "could not flush to writer")
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package account_test
+
+import (
+	"bytes"
+	"strings"
+
+	. "github.com/wpe_merge/wpe_merge/account"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Snapshot diffs", func() {
+	// load reads a snapshot with a line per account
+	load := func(created string, accounts ...string) *SnapshotClient {
+		lines := append([]string{`{"version":1,"created_at":"` + created + `"}`}, accounts...)
+		snapshot, err := LoadSnapshot(strings.NewReader(strings.Join(lines, "\n") + "\n"))
+		Ω(err).ShouldNot(HaveOccurred())
+		return snapshot
+	}
+
+	var diff *SnapshotDiff
+
+	BeforeEach(func() {
+		old := load("2020-01-01T00:00:00Z",
+			`{"account_id":1,"status":"good","created_on":"2011-01-01"}`,
+			`{"account_id":2,"status":"good","created_on":"2011-01-01"}`,
+			`{"account_id":3,"status":"good","created_on":"2011-01-01"}`,
+			`{"account_id":5,"status":"bad","created_on":"2011-01-01"}`,
+		)
+		new := load("2020-01-08T00:00:00Z",
+			`{"account_id":2,"status":"good","created_on":"2011-01-01"}`,
+			`{"account_id":3,"status":"closed","created_on":"2020-01-05"}`,
+			`{"account_id":4,"status":"good","created_on":"2020-01-06"}`,
+			`{"account_id":6,"status":"good","created_on":"2020-01-07"}`,
+		)
+		diff = DiffSnapshots(old, new)
+	})
+
+	It("should find what changed", func() {
+		Ω(diff.Changes).Should(Equal([]*SnapshotChange{
+			{AccountId: 1, Change: ChangeRemoved, OldStatus: "good"},
+			{AccountId: 3, Change: ChangeStatus, OldStatus: "good", NewStatus: "closed", StatusSetOn: "2020-01-05"},
+			{AccountId: 4, Change: ChangeAdded, NewStatus: "good", StatusSetOn: "2020-01-06"},
+			{AccountId: 5, Change: ChangeRemoved, OldStatus: "bad"},
+			{AccountId: 6, Change: ChangeAdded, NewStatus: "good", StatusSetOn: "2020-01-07"},
+		}))
+		Ω(diff.Count(ChangeAdded)).Should(Equal(2))
+		Ω(diff.Count(ChangeRemoved)).Should(Equal(2))
+		Ω(diff.Count(ChangeStatus)).Should(Equal(1))
+		Ω(diff.Old.CreatedAt.Day()).Should(Equal(1))
+		Ω(diff.New.CreatedAt.Day()).Should(Equal(8))
+	})
+
+	It("should find nothing between the same snapshot", func() {
+		snapshot := load("2020-01-01T00:00:00Z", `{"account_id":1,"status":"good","created_on":"2011-01-01"}`)
+		Ω(DiffSnapshots(snapshot, snapshot).Changes).Should(BeEmpty())
+	})
+
+	It("should write csv", func() {
+		var buf bytes.Buffer
+		Ω(diff.WriteCSV(&buf)).Should(Succeed())
+		Ω(strings.Split(buf.String(), "\n")[:3]).Should(Equal([]string{
+			"Account ID,Change,Old Status,New Status,Status Set On",
+			"1,removed,good,,",
+			"3,status,good,closed,2020-01-05",
+		}))
+	})
+})
@@ -0,0 +1,139 @@
+package account_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	. "github.com/wpe_merge/wpe_merge/account"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Snapshots", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		client *WPClient
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		client = NewWPClient(emulator.URL())
+		for i := 1; i <= 250; i++ {
+			emulator.LoadData(&Account{AccountId: i, Status: "good", CreatedOn: "2011-01-01"})
+		}
+	})
+
+	AfterEach(func() {
+		cancel()
+		emulator.ResetData()
+	})
+
+	Describe("paging", func() {
+		It("should get every page", func() {
+			var pages []int
+			err := ListAccounts(ctx, client, 100, func(page []*Account) error {
+				pages = append(pages, len(page))
+				return nil
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(pages).Should(Equal([]int{100, 100, 50}))
+
+			accts, err := AllAccounts(ctx, client, 0)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(accts).Should(HaveLen(250))
+			Ω(accts[249].AccountId).Should(Equal(250))
+		})
+
+		It("should describe the page", func() {
+			resp, err := client.GetAccounts(ctx, &GetAccountsRequest{Page: 2, PageSize: 100})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(resp.Count).Should(Equal(250))
+			Ω(resp.Results[0].AccountId).Should(Equal(101))
+			Ω(resp.Next).Should(ContainSubstring("page=3"))
+			Ω(resp.Previous).Should(ContainSubstring("page=1"))
+		})
+
+		It("should fail past the last page", func() {
+			_, err := client.GetAccounts(ctx, &GetAccountsRequest{Page: 4, PageSize: 100})
+			Ω(IsNotFound(err)).Should(BeTrue())
+		})
+	})
+
+	Describe("a snapshot", func() {
+		var snapshot *SnapshotClient
+
+		BeforeEach(func() {
+			extra := map[string]json.RawMessage{"plan": json.RawMessage(`{"name":"startup"}`)}
+			emulator.LoadData(&Account{AccountId: 7, Status: "bad", CreatedOn: "2012-02-02", Extra: extra})
+
+			var buf bytes.Buffer
+			n, err := WriteSnapshot(ctx, client, &buf, emulator.URL(), 100)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(n).Should(Equal(250))
+
+			snapshot, err = LoadSnapshot(&buf)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should keep the metadata", func() {
+			meta := snapshot.Meta()
+			Ω(meta.Version).Should(Equal(SnapshotVersion))
+			Ω(meta.Source).Should(Equal(emulator.URL()))
+			Ω(meta.CreatedAt).Should(BeTemporally("~", time.Now(), time.Minute))
+		})
+
+		It("should look up accounts", func() {
+			acct, err := snapshot.GetAccount(ctx, &GetAccountRequest{AccountId: "007"})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(acct.Status).Should(Equal("bad"))
+			Ω(acct.Field("plan.name")).Should(Equal("startup"))
+
+			_, err = snapshot.GetAccount(ctx, &GetAccountRequest{AccountId: "251"})
+			Ω(IsNotFound(err)).Should(BeTrue())
+
+			resp, err := snapshot.GetAccountsByIDs(ctx, []string{"1", "251", "2"})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(resp.Results).Should(HaveLen(2))
+		})
+
+		It("should page like the server", func() {
+			accts, err := AllAccounts(ctx, snapshot, 30)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(accts).Should(HaveLen(250))
+
+			fromServer, err := AllAccounts(ctx, client, 0)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(accts).Should(Equal(fromServer))
+		})
+
+		It("should merge like the server", func() {
+			input := "Account ID,Account Name,First Name,Created On\n" +
+				"1,jdoe,John,1/1/11\n" +
+				"7,bdole,Bob,2/2/12\n" +
+				"999,missing,Max,3/3/13\n"
+			run := func(c Client) string {
+				var w bytes.Buffer
+				err := NewWPStreamer(c, WithMaxConcurrentRequests(1)).Stream(ctx, strings.NewReader(input), &w)
+				Ω(err).ShouldNot(HaveOccurred())
+				return w.String()
+			}
+			Ω(run(snapshot)).Should(Equal(run(client)))
+		})
+	})
+
+	It("should reject a broken snapshot", func() {
+		_, err := LoadSnapshot(strings.NewReader(""))
+		Ω(err).Should(MatchError("snapshot is empty"))
+
+		_, err = LoadSnapshot(strings.NewReader(`{"version":99}` + "\n"))
+		Ω(err).Should(MatchError(ContainSubstring("unsupported snapshot version")))
+
+		_, err = LoadSnapshot(strings.NewReader(`{"version":1}` + "\n{}\nnope\n"))
+		Ω(err).Should(MatchError(ContainSubstring("line 3")))
+	})
+})
@@ -0,0 +1,381 @@
+package account
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	// registers the sqlite3 driver with database/sql
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const (
+	// DefaultSQLiteTable is the table a SQLiteWriter writes the rows to
+	// unless told otherwise
+	DefaultSQLiteTable = "accounts"
+	// SQLiteRunsTable is where a SQLiteWriter records each run, whatever
+	// table the rows went to
+	SQLiteRunsTable = "wpe_merge_runs"
+
+	// The status of a run in the runs table
+	SQLiteRunRunning = "running"
+	SQLiteRunDone    = "done"
+	SQLiteRunFailed  = "failed"
+
+	defaultSQLiteBatchSize = 1000
+)
+
+var sqliteIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// SQLiteOption is an option that can be passed into NewSQLiteWriter
+type SQLiteOption func(w *SQLiteWriter)
+
+// WithSQLiteTable returns a SQLiteOption that writes the rows to the named
+// table instead of DefaultSQLiteTable
+func WithSQLiteTable(table string) SQLiteOption {
+	return func(w *SQLiteWriter) {
+		w.table = table
+	}
+}
+
+// WithSQLiteColumnTypes returns a SQLiteOption that gives the columns named in
+// types their own type instead of text.  See ColumnTypes.
+func WithSQLiteColumnTypes(types map[string]ColumnType) SQLiteOption {
+	return func(w *SQLiteWriter) {
+		w.types = types
+	}
+}
+
+// WithSQLiteBatchSize returns a SQLiteOption that commits every n rows.  Rows
+// are also committed whenever the writer is flushed.
+func WithSQLiteBatchSize(n int) SQLiteOption {
+	if n <= 0 {
+		panic("sqlite batch size must be positive")
+	}
+	return func(w *SQLiteWriter) {
+		w.batchSize = n
+	}
+}
+
+// SQLiteWriter is a RecordWriter that stores the output in a SQLite table
+// keyed on the account id.  The table is created from the header, with the
+// standard columns typed (account_id INTEGER PRIMARY KEY, created_on and
+// status_set_on DATE), the others typed by WithSQLiteColumnTypes or as text,
+// and every column named in snake case.  Rows for an
+// account that is already in the table replace it, so the same input can be
+// run again.  Each run is recorded in SQLiteRunsTable.
+//
+// Rows are written in transactions of a batch at a time, so a run that fails
+// leaves the batches that were already committed in the table.
+type SQLiteWriter struct {
+	db        *sql.DB
+	table     string
+	types     map[string]ColumnType
+	batchSize int
+
+	runId   int64
+	columns []typedColumn
+	tx      *sql.Tx
+	insert  *sql.Stmt
+	pending int64
+	rows    int64
+	err     error
+}
+
+var _ RecordWriter = &SQLiteWriter{}
+
+// NewSQLiteWriter opens the database at path, creating it if need be, and
+// starts a run
+func NewSQLiteWriter(path string, ops ...SQLiteOption) (*SQLiteWriter, error) {
+	w := &SQLiteWriter{table: DefaultSQLiteTable, batchSize: defaultSQLiteBatchSize}
+	for _, op := range ops {
+		op(w)
+	}
+	if !sqliteIdentifier.MatchString(w.table) || strings.EqualFold(w.table, SQLiteRunsTable) {
+		return nil, errors.Errorf("invalid table name `%s`", w.table)
+	}
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not open database `%s`", path)
+	}
+	// the transaction and the statements all have to be on the same
+	// connection
+	db.SetMaxOpenConns(1)
+	w.db = db
+
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS ` + SQLiteRunsTable + ` (
+		run_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		table_name TEXT NOT NULL,
+		started_at TIMESTAMP NOT NULL,
+		finished_at TIMESTAMP,
+		rows INTEGER NOT NULL DEFAULT 0,
+		status TEXT NOT NULL
+	)`); err != nil {
+		db.Close()
+		return nil, errors.Wrapf(err, "could not create table `%s`", SQLiteRunsTable)
+	}
+	res, err := db.Exec(
+		`INSERT INTO `+SQLiteRunsTable+` (table_name, started_at, status) VALUES (?, ?, ?)`,
+		w.table, time.Now().UTC().Format(time.RFC3339), SQLiteRunRunning,
+	)
+	if err == nil {
+		w.runId, err = res.LastInsertId()
+	}
+	if err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "could not record run")
+	}
+	return w, nil
+}
+
+// Write stores a row.  The first row is the header, which sets up the table.
+func (w *SQLiteWriter) Write(record []string) error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.columns == nil {
+		w.err = w.createTable(record)
+		return w.err
+	}
+	if len(record) != len(w.columns) {
+		w.err = errors.Errorf("row has %d columns, expected %d", len(record), len(w.columns))
+		return w.err
+	}
+
+	args := make([]interface{}, len(record))
+	for i, value := range record {
+		if args[i], w.err = sqliteValue(w.columns[i], value); w.err != nil {
+			return w.err
+		}
+	}
+
+	if w.tx == nil {
+		if w.err = w.begin(); w.err != nil {
+			return w.err
+		}
+	}
+	if _, err := w.insert.Exec(args...); err != nil {
+		w.err = errors.Wrap(err, "could not insert row")
+		return w.err
+	}
+	if w.pending++; w.pending >= int64(w.batchSize) {
+		w.err = w.commit()
+	}
+	return w.err
+}
+
+// Flush commits the rows written so far
+func (w *SQLiteWriter) Flush() {
+	if w.err != nil || w.tx == nil {
+		return
+	}
+	w.err = w.commit()
+}
+
+// Error returns the first error that happened while writing
+func (w *SQLiteWriter) Error() error {
+	return w.err
+}
+
+// Close commits the last rows, records the end of the run and closes the
+// database
+func (w *SQLiteWriter) Close() error {
+	w.Flush()
+	if w.err != nil {
+		w.finish(SQLiteRunFailed)
+		w.db.Close()
+		return w.err
+	}
+	if err := w.finish(SQLiteRunDone); err != nil {
+		w.db.Close()
+		return errors.Wrap(err, "could not record run")
+	}
+	return errors.Wrap(w.db.Close(), "could not close database")
+}
+
+// Remove throws away the rows that haven't been committed and records the run
+// as failed.  Unlike the file outputs, the database is kept, since it can hold
+// the results of earlier runs.
+func (w *SQLiteWriter) Remove() error {
+	if w.tx != nil {
+		w.tx.Rollback()
+		w.tx, w.insert, w.pending = nil, nil, 0
+	}
+	err := w.finish(SQLiteRunFailed)
+	if closeErr := w.db.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Rows returns the number of rows committed so far
+func (w *SQLiteWriter) Rows() int64 {
+	return w.rows
+}
+
+// RunId returns the id of the run in SQLiteRunsTable
+func (w *SQLiteWriter) RunId() int64 {
+	return w.runId
+}
+
+// createTable works out the columns from the header, and creates the table or
+// adds any columns it is missing
+func (w *SQLiteWriter) createTable(header []string) error {
+	columns, err := typedColumns(header, w.types)
+	if err != nil {
+		return err
+	}
+	key := false
+	for _, col := range columns {
+		key = key || (col.name == "account_id" && col.typ == IntegerColumn)
+	}
+	if !key {
+		return errors.New("the output has no Account ID column to key the table on")
+	}
+
+	defs := make([]string, len(columns))
+	for i, col := range columns {
+		defs[i] = quoteSQLite(col.name) + " " + sqliteType(col)
+	}
+	if _, err := w.db.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", quoteSQLite(w.table), strings.Join(defs, ", "))); err != nil {
+		return errors.Wrapf(err, "could not create table `%s`", w.table)
+	}
+
+	// a table left by an earlier run may not have every column
+	existing, err := w.tableColumns()
+	if err != nil {
+		return err
+	}
+	for _, col := range columns {
+		if existing[col.name] {
+			continue
+		}
+		if _, err := w.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", quoteSQLite(w.table), quoteSQLite(col.name), strings.TrimSuffix(sqliteType(col), " PRIMARY KEY"))); err != nil {
+			return errors.Wrapf(err, "could not add column `%s`", col.name)
+		}
+	}
+
+	w.columns = columns
+	return nil
+}
+
+// tableColumns returns the names of the columns the table has
+func (w *SQLiteWriter) tableColumns() (map[string]bool, error) {
+	rows, err := w.db.Query("SELECT name FROM pragma_table_info(?)", w.table)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read table `%s`", w.table)
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, errors.Wrapf(err, "could not read table `%s`", w.table)
+		}
+		columns[name] = true
+	}
+	return columns, errors.Wrapf(rows.Err(), "could not read table `%s`", w.table)
+}
+
+// begin starts the next batch
+func (w *SQLiteWriter) begin() error {
+	names := make([]string, len(w.columns))
+	params := make([]string, len(w.columns))
+	var updates []string
+	for i, col := range w.columns {
+		names[i] = quoteSQLite(col.name)
+		params[i] = "?"
+		if col.name != "account_id" {
+			updates = append(updates, fmt.Sprintf("%s = excluded.%s", names[i], names[i]))
+		}
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (account_id) DO ",
+		quoteSQLite(w.table), strings.Join(names, ", "), strings.Join(params, ", "))
+	if len(updates) > 0 {
+		query += "UPDATE SET " + strings.Join(updates, ", ")
+	} else {
+		query += "NOTHING"
+	}
+
+	tx, err := w.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "could not start transaction")
+	}
+	insert, err := tx.Prepare(query)
+	if err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "could not prepare insert")
+	}
+	w.tx, w.insert = tx, insert
+	return nil
+}
+
+// commit ends the current batch
+func (w *SQLiteWriter) commit() error {
+	tx := w.tx
+	w.tx, w.insert = nil, nil
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "could not commit rows")
+	}
+	w.rows += w.pending
+	w.pending = 0
+	return nil
+}
+
+// finish records how the run ended
+func (w *SQLiteWriter) finish(status string) error {
+	_, err := w.db.Exec(
+		`UPDATE `+SQLiteRunsTable+` SET finished_at = ?, rows = ?, status = ? WHERE run_id = ?`,
+		time.Now().UTC().Format(time.RFC3339), w.rows, status, w.runId,
+	)
+	return err
+}
+
+// sqliteType is the declared type of the column, with the account id as the
+// key
+func sqliteType(col typedColumn) string {
+	switch {
+	case col.typ == IntegerColumn && col.name == "account_id":
+		return "INTEGER PRIMARY KEY"
+	case col.typ == IntegerColumn:
+		return "INTEGER"
+	case col.typ == NumberColumn:
+		return "REAL"
+	case col.typ == BooleanColumn:
+		return "BOOLEAN"
+	case col.typ == DateColumn:
+		return "DATE"
+	}
+	return "TEXT"
+}
+
+// sqliteValue converts a field to what is stored in the column.  Empty fields
+// are stored as NULL, booleans as 1 or 0, and dates as YYYY-MM-DD where they
+// can be read, so that sqlite's date functions work on them.
+func sqliteValue(col typedColumn, field string) (interface{}, error) {
+	switch {
+	case field == "":
+		return nil, nil
+	case col.typ == IntegerColumn:
+		return col.integer(field)
+	case col.typ == NumberColumn:
+		return col.number(field)
+	case col.typ == BooleanColumn:
+		return col.boolean(field)
+	case col.typ == DateColumn:
+		if t, ok := col.date(field); ok {
+			return t.Format("2006-01-02"), nil
+		}
+	}
+	return field, nil
+}
+
+func quoteSQLite(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
@@ -0,0 +1,202 @@
+package account_test
+
+import (
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/wpe_merge/wpe_merge/account"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SQLiteWriter", func() {
+	var (
+		dir  string
+		path string
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "sqlite")
+		Ω(err).ShouldNot(HaveOccurred())
+		path = filepath.Join(dir, "out.db")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	header := []string{"Account ID", "First Name", "Created On", "Status", "Status Set On"}
+
+	// write runs the records through a new writer and closes it
+	write := func(records [][]string, ops ...SQLiteOption) {
+		w, err := NewSQLiteWriter(path, ops...)
+		Ω(err).ShouldNot(HaveOccurred())
+		for _, record := range records {
+			Ω(w.Write(record)).Should(Succeed())
+		}
+		Ω(w.Close()).Should(Succeed())
+	}
+
+	// query returns the rows of the query as strings, with NULL as "NULL".
+	// The driver reads DATE columns as times, so they are cast to text.
+	query := func(q string) [][]string {
+		db, err := sql.Open("sqlite3", path)
+		Ω(err).ShouldNot(HaveOccurred())
+		defer db.Close()
+
+		rows, err := db.Query(q)
+		Ω(err).ShouldNot(HaveOccurred())
+		defer rows.Close()
+		columns, err := rows.Columns()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		var results [][]string
+		for rows.Next() {
+			values := make([]sql.NullString, len(columns))
+			ptrs := make([]interface{}, len(columns))
+			for i := range values {
+				ptrs[i] = &values[i]
+			}
+			Ω(rows.Scan(ptrs...)).Should(Succeed())
+			row := make([]string, len(values))
+			for i, v := range values {
+				row[i] = "NULL"
+				if v.Valid {
+					row[i] = v.String
+				}
+			}
+			results = append(results, row)
+		}
+		Ω(rows.Err()).ShouldNot(HaveOccurred())
+		return results
+	}
+
+	It("should store the rows in a typed table", func() {
+		write([][]string{
+			header,
+			{"007", "John", "01/12/2011", "good", "2011-01-12"},
+			{"2", "Bob", "2012-02-02", "", ""},
+		})
+
+		Ω(query(`SELECT account_id, typeof(account_id), first_name, CAST(created_on AS TEXT), status, CAST(status_set_on AS TEXT) FROM accounts ORDER BY account_id`)).Should(Equal([][]string{
+			{"2", "integer", "Bob", "2012-02-02", "NULL", "NULL"},
+			{"7", "integer", "John", "2011-01-12", "good", "2011-01-12"},
+		}))
+		Ω(query(`SELECT name, type, pk FROM pragma_table_info('accounts')`)).Should(Equal([][]string{
+			{"account_id", "INTEGER", "1"},
+			{"first_name", "TEXT", "0"},
+			{"created_on", "DATE", "0"},
+			{"status", "TEXT", "0"},
+			{"status_set_on", "DATE", "0"},
+		}))
+	})
+
+	It("should replace accounts on a second run", func() {
+		write([][]string{header, {"1", "John", "2011-01-01", "good", "2011-01-01"}})
+		write([][]string{header, {"1", "John", "2011-01-01", "closed", "2020-01-01"}, {"2", "Bob", "", "", ""}})
+
+		Ω(query(`SELECT account_id, status FROM accounts ORDER BY account_id`)).Should(Equal([][]string{
+			{"1", "closed"},
+			{"2", "NULL"},
+		}))
+		Ω(query(`SELECT run_id, table_name, rows, status FROM ` + SQLiteRunsTable)).Should(Equal([][]string{
+			{"1", "accounts", "1", SQLiteRunDone},
+			{"2", "accounts", "2", SQLiteRunDone},
+		}))
+	})
+
+	It("should commit in batches", func() {
+		w, err := NewSQLiteWriter(path, WithSQLiteBatchSize(2))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(w.Write(header)).Should(Succeed())
+		for _, id := range []string{"1", "2", "3"} {
+			Ω(w.Write([]string{id, "", "", "", ""})).Should(Succeed())
+		}
+		Ω(w.Rows()).Should(BeEquivalentTo(2))
+
+		// the rows that weren't committed are thrown away
+		Ω(w.Remove()).Should(Succeed())
+		Ω(query(`SELECT count(*) FROM accounts`)).Should(Equal([][]string{{"2"}}))
+		Ω(query(`SELECT rows, status FROM ` + SQLiteRunsTable)).Should(Equal([][]string{{"2", SQLiteRunFailed}}))
+	})
+
+	It("should store other columns as text", func() {
+		write([][]string{
+			append(header, "plan.name", "Source File"),
+			{"1", "John", "", "good", "", "startup", "in.csv"},
+		}, WithSQLiteTable("merged"))
+
+		Ω(query(`SELECT account_id, plan_name, source_file FROM merged`)).Should(Equal([][]string{{"1", "startup", "in.csv"}}))
+
+		// a later run can add columns
+		write([][]string{append(header, "Label"), {"1", "John", "", "good", "", "vip"}}, WithSQLiteTable("merged"))
+		Ω(query(`SELECT plan_name, label FROM merged`)).Should(Equal([][]string{{"startup", "vip"}}))
+	})
+
+	It("should type the columns it is told about", func() {
+		types := map[string]ColumnType{"Days": IntegerColumn, "Score": NumberColumn, "Changed": BooleanColumn, "Closed On": DateColumn}
+		write([][]string{
+			append(header, "Days", "Score", "Changed", "Closed On", "Label"),
+			{"1", "John", "", "good", "", "46", "2.5", "true", "03/01/2020", "vip"},
+			{"2", "Bob", "", "", "", "", "", "", "", ""},
+		}, WithSQLiteColumnTypes(types))
+
+		// booleans are stored as 1 or 0, though the driver reads them back as
+		// bools
+		Ω(query(`SELECT days, typeof(days), score, typeof(score), CAST(changed AS TEXT), CAST(closed_on AS TEXT), label FROM accounts ORDER BY account_id`)).Should(Equal([][]string{
+			{"46", "integer", "2.5", "real", "1", "2020-03-01", "vip"},
+			{"NULL", "null", "NULL", "null", "NULL", "NULL", "NULL"},
+		}))
+		Ω(query(`SELECT name, type FROM pragma_table_info('accounts') WHERE cid >= 5`)).Should(Equal([][]string{
+			{"days", "INTEGER"},
+			{"score", "REAL"},
+			{"changed", "BOOLEAN"},
+			{"closed_on", "DATE"},
+			{"label", "TEXT"},
+		}))
+	})
+
+	It("should reject rows it can't store", func() {
+		w, err := NewSQLiteWriter(path)
+		Ω(err).ShouldNot(HaveOccurred())
+		defer w.Remove()
+		Ω(w.Write(header)).Should(Succeed())
+		Ω(w.Write([]string{"abc", "", "", "", ""})).Should(MatchError(ContainSubstring("not an integer")))
+		Ω(w.Error()).Should(HaveOccurred())
+	})
+
+	It("should reject outputs without an account id", func() {
+		w, err := NewSQLiteWriter(path)
+		Ω(err).ShouldNot(HaveOccurred())
+		defer w.Remove()
+		Ω(w.Write([]string{"First Name", "Status"})).Should(MatchError(ContainSubstring("Account ID")))
+	})
+
+	It("should reject bad table names", func() {
+		_, err := NewSQLiteWriter(path, WithSQLiteTable("accounts; DROP TABLE x"))
+		Ω(err).Should(MatchError(ContainSubstring("invalid table name")))
+	})
+
+	It("should take the output of a run", func() {
+		emulator.LoadData(&Account{AccountId: 1, Status: "good", CreatedOn: "2011-01-01"})
+		defer emulator.ResetData()
+
+		w, err := NewSQLiteWriter(path)
+		Ω(err).ShouldNot(HaveOccurred())
+		input := "Account ID,Account Name,First Name,Created On\n1,jdoe,John,01/01/2011\n2,bdole,Bob,02/02/2012\n"
+		_, err = NewWPStreamer(NewWPClient(emulator.URL())).RunRecords(context.Background(), strings.NewReader(input), w)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(w.Close()).Should(Succeed())
+
+		Ω(query(`SELECT account_id, first_name, CAST(created_on AS TEXT), status, CAST(status_set_on AS TEXT) FROM accounts ORDER BY account_id`)).Should(Equal([][]string{
+			{"1", "John", "2011-01-01", "good", "2011-01-01"},
+			{"2", "Bob", "2012-02-02", "NULL", "NULL"},
+		}))
+	})
+})
@@ -4,11 +4,14 @@ import (
 	"context"
 	"encoding/csv"
 	"io"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/sync/errgroup"
-	"golang.org/x/sync/semaphore"
+	"golang.org/x/sync/singleflight"
 )
 
 var (
@@ -23,6 +26,8 @@ var (
 		"Status",
 		"Status Set On",
 	}
+
+	errHeader = append(append([]string{}, inHeader...), "Error")
 )
 
 // WPStreamerOption is an option that can be passed into the WPStreamer
@@ -39,11 +44,119 @@ func WithMaxConcurrentRequests(n int64) WPStreamerOption {
 	}
 }
 
+// WithDateFormatter returns a WPStreamerOption that normalizes the Created On
+// and Status Set On columns.  Without it, dates are written exactly as they
+// were received.
+func WithDateFormatter(f *DateFormatter) WPStreamerOption {
+	return func(s *WPStreamer) {
+		s.dates = f
+	}
+}
+
+// WithValidator returns a WPStreamerOption that rejects rows before they are
+// looked up on the server.  Rejected rows are not written to the output.
+func WithValidator(v *Validator) WPStreamerOption {
+	return func(s *WPStreamer) {
+		s.validator = v
+	}
+}
+
+// WithErrorWriter returns a WPStreamerOption that records every row that was
+// rejected or had a problem as csv, along with the reason.
+func WithErrorWriter(w io.Writer) WPStreamerOption {
+	return func(s *WPStreamer) {
+		s.errWriter = newSyncWriter(w)
+	}
+}
+
+// WithDedupePolicy returns a WPStreamerOption that decides what to do with rows
+// that share an account id.  The default is DedupeKeepAll.
+func WithDedupePolicy(policy DedupePolicy) WPStreamerOption {
+	return func(s *WPStreamer) {
+		s.dedupe = policy
+	}
+}
+
+// WithFilter returns a WPStreamerOption that only writes the records that match
+// the filter.  The filter sees the dates as they were received, before they are
+// normalized.
+func WithFilter(f *Filter) WPStreamerOption {
+	return func(s *WPStreamer) {
+		s.filter = f
+	}
+}
+
+// WithExcludeMissing returns a WPStreamerOption that drops the rows that could
+// not be looked up on the server
+func WithExcludeMissing() WPStreamerOption {
+	return func(s *WPStreamer) {
+		s.excludeMissing = true
+	}
+}
+
+// WithColumns returns a WPStreamerOption that adds computed columns to the end
+// of the output
+func WithColumns(cols ...*Column) WPStreamerOption {
+	return func(s *WPStreamer) {
+		s.columns = append(s.columns, cols...)
+	}
+}
+
+// WithAllServerFields returns a WPStreamerOption that adds a column for every
+// field in the server response that doesn't already have one.  The columns
+// come from the first account that is found, so the header isn't written until
+// then.
+func WithAllServerFields() WPStreamerOption {
+	return func(s *WPStreamer) {
+		s.allServerFields = true
+	}
+}
+
+// WithFlushEvery returns a WPStreamerOption that flushes the output after every
+// n rows.  Without it, the output is flushed whenever the writer's buffer fills
+// up and at the end of the run.
+func WithFlushEvery(n int64) WPStreamerOption {
+	return func(s *WPStreamer) {
+		s.flushRows = n
+	}
+}
+
+// WithFlushInterval returns a WPStreamerOption that flushes the output on a
+// timer, so that rows show up even when they trickle in
+func WithFlushInterval(d time.Duration) WPStreamerOption {
+	return func(s *WPStreamer) {
+		s.flushInterval = d
+	}
+}
+
 // WPStreamer is the mechanism which we will transform the results.  It will
 // read from the input, look up the record and dump the output.
 type WPStreamer struct {
 	client                Client
 	maxConcurrentRequests int64
+	// limit throttles the requests made to the server.  It belongs to the
+	// streamer rather than a run so that concurrent runs share the limit.
+	limit           limiter
+	adaptiveMin     int64
+	adaptiveMax     int64
+	dates           *DateFormatter
+	validator       *Validator
+	errWriter       *syncWriter
+	dedupe          DedupePolicy
+	filter          *Filter
+	excludeMissing  bool
+	columns         []*Column
+	allServerFields bool
+	readers         int
+	flushRows       int64
+	flushInterval   time.Duration
+	maxMemory       int64
+	batchSize       int
+	onFailure       FailurePolicy
+
+	// lookups makes sure that concurrent requests for the same account id
+	// share a single http request
+	lookups *singleflight.Group
 }
 
 // NewWPStreamer instantiates a new WPStreamer
@@ -51,39 +164,68 @@ func NewWPStreamer(client Client, ops ...WPStreamerOption) *WPStreamer {
 	s := &WPStreamer{
 		client:                client,
 		maxConcurrentRequests: 10, // Default
+		batchSize:             1,
+		dedupe:                DedupeKeepAll,
+		onFailure:             FailureContinue,
+		lookups:               &singleflight.Group{},
 	}
 	for _, op := range ops {
 		op(s)
 	}
+	if s.adaptiveMax > 0 {
+		s.limit = newAdaptiveLimiter(s.maxConcurrentRequests, s.adaptiveMin, s.adaptiveMax)
+	} else {
+		s.limit = newFixedLimiter(s.maxConcurrentRequests)
+	}
 	return s
 }
 
+// Clone returns a copy of the streamer with the options applied on top, for
+// runs that need settings of their own, like a validator that only checks one
+// output.  The copy shares the limit on concurrent requests and the lookups in
+// flight with the original, so options that change the limit have no effect.
+func (s *WPStreamer) Clone(ops ...WPStreamerOption) *WPStreamer {
+	c := *s
+	c.columns = append([]*Column{}, s.columns...)
+	for _, op := range ops {
+		op(&c)
+	}
+	return &c
+}
+
 // Stream transforms the input into the desired out format
 func (s *WPStreamer) Stream(ctx context.Context, r io.Reader, w io.Writer) error {
-	log := logrus.WithContext(ctx)
+	_, err := s.Run(ctx, r, w)
+	return err
+}
 
-	cr := csv.NewReader(r)
-	cr.FieldsPerRecord = 4
+// Run is like Stream, but it also returns a summary of what happened to the
+// rows.  The summary is returned even if the run fails.
+func (s *WPStreamer) Run(ctx context.Context, r io.Reader, w io.Writer) (*Summary, error) {
+	return s.RunRecords(ctx, r, csv.NewWriter(w))
+}
 
-	cw := csv.NewWriter(w)
+// RunRecords is like Run, but it sends the rows to a RecordWriter instead of
+// writing them as csv.  The first row written is the header.
+func (s *WPStreamer) RunRecords(ctx context.Context, r io.Reader, w RecordWriter) (*Summary, error) {
+	sum := &Summary{}
+	err := s.run(ctx, r, w, sum)
+	s.flushErrors(ctx)
+	return sum, err
+}
 
-	// read the header line
-	record, err := cr.Read()
-	if err != nil {
-		return errors.Wrap(err, "could not read header")
-	}
-	if err := validateInHeader(record); err != nil {
-		return errors.Wrap(err, "could not read header")
+func (s *WPStreamer) run(ctx context.Context, r io.Reader, w RecordWriter, sum *Summary) error {
+	// Files can be split up and read in parallel
+	if s.readers > 1 {
+		if f, ok := r.(seekableReader); ok {
+			return s.runChunks(ctx, f, w, sum)
+		}
 	}
 
-	// write the header line
-	if err := cw.Write(outHeader); err != nil {
-		// Errors won't typically show up here because the csv writer requires a
-		// call to Flush before data gets written to the outfile.  So, I guess
-		// the primary case is if we run out of memory.  If that is an often
-		// enough use case, then we can consider flushing after writing a set
-		// number of rows
-		return errors.Wrap(err, "could not write header")
+	cr := csv.NewReader(r)
+	out, err := s.open(cr, w, sum)
+	if err != nil {
+		return err
 	}
 
 	// There are a few ways we can implement this next bit, so I will go over
@@ -111,82 +253,373 @@ func (s *WPStreamer) Stream(ctx context.Context, r io.Reader, w io.Writer) error
 	// The upside to this approach is that it is pretty easy to implement and
 	// easy things can be worthwhile to do when you know you are going to have
 	// to change it later, but don't know how yet.
+	//
+	// Now that the client has GetAccountsByIDs, WithBatchSize gives us option 1
+	// in chunks, while the default is still option 3.
 
-	g, gctx := errgroup.WithContext(ctx)
-	sem := semaphore.NewWeighted(s.maxConcurrentRequests)
+	p := newPass(ctx, s, out, sum)
+	p.skipDuplicates = s.dedupe == DedupeKeepFirst
+	b := p.newBatch()
 
-	for {
+	for index := int64(0); ; index++ {
 		// read the record from the input
 		raw, err := cr.Read()
 		if err == io.EOF {
-			// wait for all pending processes to finish
-			if err := g.Wait(); err != nil {
-				return errors.Wrap(err, "could not process data")
+			// look up whatever is left over
+			if err := b.flush(); err != nil {
+				return p.fail(err)
 			}
-
-			// flush the write buffer and make sure everything is a-ok
-			cw.Flush()
-			if err := cw.Error(); err != nil {
-				return errors.Wrap(err, "could not flush to writer")
-			}
-
-			return nil
+			return p.finish()
 		} else if err != nil {
 			// Wait for all pending processes to finish
-			if err := g.Wait(); err != nil {
+			if err := p.wait(); err != nil {
 				// log any additional errors that may otherwise be swallowed
-				log.WithError(err).Error("Could not process data")
+				logrus.WithContext(ctx).WithError(err).Error("Could not process data")
 			}
 			return errors.Wrap(err, "could not read row")
 		}
 
-		inRecord := InRecord(raw)
+		if err := p.process(b, InRecord(raw), index); err != nil {
+			return p.fail(err)
+		}
+	}
+}
 
-		// Acquire a resource that will permit the creation of a http request.
-		// We use a semaphore here in order to throttle the number of
-		// concurrent requests made to the server.
-		err = sem.Acquire(gctx, 1)
-		if err != nil {
-			if err := g.Wait(); err != nil {
-				return errors.Wrap(err, "could not process data")
-			}
-			return errors.Wrap(err, "could not process data")
+// open reads and checks the input header, then writes the output header
+func (s *WPStreamer) open(cr *csv.Reader, w RecordWriter, sum *Summary) (*output, error) {
+	if err := readHeader(cr); err != nil {
+		return nil, err
+	}
+
+	// Rows are written from several goroutines, so writes need to take turns
+	out := newOutput(s, &syncWriter{cw: w}, sum)
+	if err := out.open(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// pass is a single run over an input.  Rows are looked up in the background,
+// so everything here is shared between goroutines.
+type pass struct {
+	s   *WPStreamer
+	ctx context.Context
+	out *output
+	sum *Summary
+
+	g    *errgroup.Group
+	gctx context.Context
+
+	// Keep track of the account ids we've seen so that we can count (and
+	// maybe drop) the duplicates.  Policies that pick a row other than the
+	// first are handled by the output, which holds on to the rows until the
+	// end.
+	mu             sync.Mutex
+	seen           map[string]struct{}
+	skipDuplicates bool
+
+	// done stops the flush timer once the lookups have finished
+	done     chan struct{}
+	flushing sync.WaitGroup
+}
+
+func newPass(ctx context.Context, s *WPStreamer, out *output, sum *Summary) *pass {
+	g, gctx := errgroup.WithContext(ctx)
+	p := &pass{
+		s:    s,
+		ctx:  ctx,
+		out:  out,
+		sum:  sum,
+		g:    g,
+		gctx: gctx,
+		seen: make(map[string]struct{}),
+		done: make(chan struct{}),
+	}
+	if s.flushInterval > 0 {
+		p.flushEvery(s.flushInterval)
+	}
+	return p
+}
+
+// process checks the row and adds it to the batch to be looked up.  The index
+// only has to sort the rows into input order.
+func (p *pass) process(b *batch, inRecord InRecord, index int64) error {
+	s, sum := p.s, p.sum
+	atomic.AddInt64(&sum.Rows, 1)
+
+	// Reject bad rows before we spend a request on them
+	if s.validator != nil {
+		if err := s.validator.Validate(inRecord); err != nil {
+			atomic.AddInt64(&sum.Invalid, 1)
+			s.rowError(p.ctx, inRecord, errors.Wrap(err, "invalid row"))
+			return nil
 		}
+	}
 
-		g.Go(func() error {
-			defer sem.Release(1)
+	accountId := normalizeAccountId(inRecord.AccountId())
+	duplicate, err := p.duplicate(accountId)
+	if err != nil {
+		return err
+	}
+	if duplicate {
+		atomic.AddInt64(&sum.Duplicates, 1)
+		if p.skipDuplicates {
+			return nil
+		}
+	}
 
-			// prepare the output
-			outRecord := []string{
-				inRecord.AccountId(),
-				inRecord.FirstName(),
-				inRecord.CreatedOn(),
-				"",
-				"",
-			}
+	return b.add(lookupRow{
+		inRecord:  inRecord,
+		accountId: accountId,
+		index:     index,
+	})
+}
 
-			// Get the account from the server
-			resp, err := s.client.GetAccount(gctx, &GetAccountRequest{
-				AccountId: inRecord.AccountId(),
-			})
-			if err != nil {
-				// log an error if there is a problem with a record
-				log.WithError(err).WithField("account_id", inRecord.AccountId()).Error("Could not look up account id")
-			} else {
-				// populate the record with the response from the server
-				outRecord[3] = resp.Status
-				outRecord[4] = resp.CreatedOn
-			}
+// finishRow merges the row with the account the server sent back and sends it
+// to the output
+func (p *pass) finishRow(row lookupRow, resp *Account, err error) error {
+	s, sum, inRecord := p.s, p.sum, row.inRecord
+	if err != nil {
+		atomic.AddInt64(&sum.Failed, 1)
+		s.rowError(p.ctx, inRecord, errors.Wrap(err, "could not look up account id"))
+		if s.onFailure.abort(err) {
+			return errors.Wrapf(err, "stopping after account id %s failed", row.accountId)
+		}
+		resp = nil
+	}
+	record := NewRecord(inRecord, resp)
+
+	// drop the rows nobody asked for
+	if !s.keep(record) {
+		atomic.AddInt64(&sum.Filtered, 1)
+		return nil
+	}
+
+	// computed columns see the record before the dates are normalized
+	columns := s.computeColumns(p.ctx, inRecord, record)
+	s.formatDates(p.ctx, inRecord, record)
+
+	return p.out.write(outputRow{
+		accountId: row.accountId,
+		index:     row.index,
+		record:    record,
+		columns:   columns,
+	})
+}
+
+// duplicate marks the account id as seen, returning true if it already was
+func (p *pass) duplicate(accountId string) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, seen := p.seen[accountId]; seen {
+		return true, nil
+	}
+	if err := p.out.mem.reserve(seenIdSize + int64(len(accountId))); err != nil {
+		return false, err
+	}
+	p.seen[accountId] = struct{}{}
+	return false, nil
+}
+
+// flushEvery flushes the output on a timer until the lookups have finished
+func (p *pass) flushEvery(interval time.Duration) {
+	p.flushing.Add(1)
+	go func() {
+		defer p.flushing.Done()
 
-			// dump the output
-			if err := cw.Write(outRecord); err != nil {
-				// Again, errors shouldn't really appear here since the real
-				// magic doesn't happen until we do a call to Flush
-				return errors.Wrap(err, "could not write row")
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.done:
+				return
+			case <-ticker.C:
+				// write errors stick, so they still turn up when the
+				// output is closed
+				if err := p.out.w.Flush(); err != nil {
+					return
+				}
 			}
-			return nil
+		}
+	}()
+}
+
+// wait waits for all pending lookups and stops the flush timer
+func (p *pass) wait() error {
+	err := p.g.Wait()
+	close(p.done)
+	p.flushing.Wait()
+	return err
+}
+
+// finish waits for all pending lookups, then writes anything that was held
+// back and flushes
+func (p *pass) finish() error {
+	if err := p.wait(); err != nil {
+		return errors.Wrap(err, "could not process data")
+	}
+	return p.out.close()
+}
+
+// fail waits for all pending lookups after the pass had to stop early.  An
+// error from a lookup wins, since it is usually why we stopped.
+func (p *pass) fail(err error) error {
+	if err := p.wait(); err != nil {
+		return errors.Wrap(err, "could not process data")
+	}
+	return err
+}
+
+// header returns the output header, including any computed columns and
+// server fields
+func (s *WPStreamer) header(serverFields []string) []string {
+	header := append([]string{}, outHeader...)
+	for _, col := range s.columns {
+		header = append(header, col.Name)
+	}
+	return append(header, serverFields...)
+}
+
+// computeColumns returns the values of the computed columns for the record.
+// Columns that fail are left blank.
+func (s *WPStreamer) computeColumns(ctx context.Context, inRecord InRecord, record *Record) []string {
+	values := make([]string, len(s.columns))
+	for i, col := range s.columns {
+		value, err := col.Value(record)
+		if err != nil {
+			s.rowError(ctx, inRecord, err)
+			continue
+		}
+		values[i] = value
+	}
+	return values
+}
+
+// keep returns true if the record should be written to the output
+func (s *WPStreamer) keep(record *Record) bool {
+	if s.excludeMissing && !record.Found() {
+		return false
+	}
+	return s.filter == nil || s.filter.Match(record)
+}
+
+// formatDates normalizes the dates in the record.  Dates that can't be parsed
+// keep their original value so that nothing is lost.
+func (s *WPStreamer) formatDates(ctx context.Context, inRecord InRecord, record *Record) {
+	if s.dates == nil {
+		return
+	}
+	for _, field := range []struct {
+		name  string
+		value *string
+	}{
+		{"Created On", &record.CreatedOn},
+		{"Status Set On", &record.StatusSetOn},
+	} {
+		if *field.value == "" {
+			continue
+		}
+		date, err := s.dates.Format(*field.value)
+		if err != nil {
+			s.rowError(ctx, inRecord, errors.Wrapf(err, "could not format %s", field.name))
+			continue
+		}
+		*field.value = date
+	}
+}
+
+// lookup gets the account from the server.  Lookups for an account id that is
+// already in flight wait for that request rather than making their own, which
+// is why the account id needs to be normalized first.
+func (s *WPStreamer) lookup(ctx context.Context, accountId string) (*Account, error) {
+	resp, err, _ := s.lookups.Do(accountId, func() (interface{}, error) {
+		return s.client.GetAccount(ctx, &GetAccountRequest{
+			AccountId: accountId,
 		})
+	})
+	if err != nil {
+		return nil, err
 	}
+	return resp.(*Account), nil
+}
+
+// rowError reports a problem with a single row.  Row errors don't stop the
+// stream; the row is still written with whatever data we could gather, unless
+// it was rejected outright.
+func (s *WPStreamer) rowError(ctx context.Context, inRecord InRecord, err error) {
+	log := logrus.WithContext(ctx).WithError(err).WithField("account_id", inRecord.AccountId())
+	log.Error("Could not process row")
+
+	if s.errWriter == nil {
+		return
+	}
+	// The header is written lazily so that an empty error file means there
+	// were no errors
+	s.errWriter.once.Do(func() {
+		if err := s.errWriter.Write(errHeader); err != nil {
+			log.WithError(err).Error("Could not write error header")
+		}
+	})
+	errRecord := append(append([]string{}, inRecord...), err.Error())
+	if err := s.errWriter.Write(errRecord); err != nil {
+		log.WithError(err).Error("Could not write error row")
+	}
+}
+
+// flushErrors writes any buffered rows to the error writer
+func (s *WPStreamer) flushErrors(ctx context.Context) {
+	if s.errWriter == nil {
+		return
+	}
+	if err := s.errWriter.Flush(); err != nil {
+		logrus.WithContext(ctx).WithError(err).Error("Could not flush error rows")
+	}
+}
+
+// RecordWriter is where the streamer sends its rows.  It is satisfied by
+// *csv.Writer, so anything that can stand in for one can be used as an output.
+type RecordWriter interface {
+	Write(record []string) error
+	Flush()
+	Error() error
+}
+
+// syncWriter is a RecordWriter that is safe to use from multiple goroutines
+type syncWriter struct {
+	mu   sync.Mutex
+	once sync.Once
+	cw   RecordWriter
+}
+
+func newSyncWriter(w io.Writer) *syncWriter {
+	return &syncWriter{cw: csv.NewWriter(w)}
+}
+
+func (w *syncWriter) Write(record []string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.cw.Write(record)
+}
+
+func (w *syncWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.cw.Flush()
+	return w.cw.Error()
+}
+
+// readHeader reads the header line and makes sure it is the one we expect
+func readHeader(cr *csv.Reader) error {
+	cr.FieldsPerRecord = 4
+
+	record, err := cr.Read()
+	if err != nil {
+		return errors.Wrap(err, "could not read header")
+	}
+	if err := validateInHeader(record); err != nil {
+		return errors.Wrap(err, "could not read header")
+	}
+	return nil
 }
 
 func validateInHeader(record []string) error {
@@ -4,7 +4,10 @@ import (
 	"bytes"
 	"context"
 	"encoding/csv"
+	"encoding/json"
 	"io"
+	"io/ioutil"
+	"time"
 
 	"github.com/pkg/errors"
 	. "github.com/wpe_merge/wpe_merge/account"
@@ -189,4 +192,314 @@ var _ = Describe("Streamer", func() {
 			{"4", "Gladys", "2020-03-03", "grape", "2019-10-10"},
 		})
 	})
+
+	It("should normalize dates when a date formatter is provided", func() {
+		streamer = NewWPStreamer(client, WithDateFormatter(NewDateFormatter("iso", nil)))
+
+		client.On("GetAccount", mockCtx, &GetAccountRequest{AccountId: "1"}).
+			Return(&Account{
+				AccountId: 1,
+				Status:    "good",
+				CreatedOn: "12/12/2019",
+			}, nil)
+
+		client.On("GetAccount", mockCtx, &GetAccountRequest{AccountId: "2"}).
+			Return(&Account{
+				AccountId: 2,
+				Status:    "great",
+				CreatedOn: "2019-11-11T10:00:00Z",
+			}, nil)
+
+		var (
+			r = getReader([][]string{
+				{"Account ID", "Account Name", "First Name", "Created On"},
+				{"1", "jdoe", "Jane", "01/01/2020"},
+				{"2", "bdole", "Bob", "not a date"},
+			})
+
+			w = &bytes.Buffer{}
+		)
+
+		err := streamer.Stream(ctx, r, w)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		assertWriter(w.Bytes(), [][]string{
+			{"1", "Jane", "2020-01-01", "good", "2019-12-12"},
+			{"2", "Bob", "not a date", "great", "2019-11-11"},
+		})
+	})
+
+	It("should reject invalid rows before looking them up", func() {
+		var errs bytes.Buffer
+		streamer = NewWPStreamer(client,
+			WithValidator(NewValidator(DefaultRules(0)...)),
+			WithErrorWriter(&errs),
+		)
+
+		client.On("GetAccount", mockCtx, &GetAccountRequest{AccountId: "1"}).
+			Return(&Account{
+				AccountId: 1,
+				Status:    "good",
+				CreatedOn: "2019-12-12",
+			}, nil)
+
+		var (
+			r = getReader([][]string{
+				{"Account ID", "Account Name", "First Name", "Created On"},
+				{"1", "jdoe", "Jane", "2020-01-01"},
+				{"bob", "bdole", "Bob", "2020-02-02"},
+			})
+
+			w = &bytes.Buffer{}
+		)
+
+		sum, err := streamer.Run(ctx, r, w)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(*sum).Should(Equal(Summary{Rows: 2, Invalid: 1, Written: 1}))
+
+		assertWriter(w.Bytes(), [][]string{
+			{"1", "Jane", "2020-01-01", "good", "2019-12-12"},
+		})
+
+		errRecords, err := csv.NewReader(&errs).ReadAll()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(errRecords).Should(Equal([][]string{
+			{"Account ID", "Account Name", "First Name", "Created On", "Error"},
+			{"bob", "bdole", "Bob", "2020-02-02", "invalid row: Account ID `bob` must be a positive integer"},
+		}))
+	})
+
+	It("should let clones check their input on their own", func() {
+		streamer = NewWPStreamer(stubClient{}, WithValidator(NewValidator(DuplicateRule())))
+		input := [][]string{
+			{"Account ID", "Account Name", "First Name", "Created On"},
+			{"1", "jdoe", "Jane", "2020-01-01"},
+		}
+
+		// the original remembers the ids from every run
+		sum, err := streamer.Run(ctx, getReader(input), &bytes.Buffer{})
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(sum.Written).Should(BeEquivalentTo(1))
+		sum, err = streamer.Run(ctx, getReader(input), &bytes.Buffer{})
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(sum.Invalid).Should(BeEquivalentTo(1))
+
+		for i := 0; i < 2; i++ {
+			clone := streamer.Clone(WithValidator(NewValidator(DuplicateRule())))
+			sum, err := clone.Run(ctx, getReader(input), &bytes.Buffer{})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(sum.Written).Should(BeEquivalentTo(1))
+		}
+	})
+
+	It("should share the request limit with its clones", func() {
+		client := &fakeClient{behave: func(call int64, inflight int) (time.Duration, error) {
+			return 5 * time.Millisecond, nil
+		}}
+		streamer = NewWPStreamer(client, WithMaxConcurrentRequests(2))
+
+		done := make(chan struct{})
+		for i := 0; i < 3; i++ {
+			clone := streamer.Clone()
+			go func() {
+				defer GinkgoRecover()
+				defer func() { done <- struct{}{} }()
+				_, err := clone.Run(ctx, syntheticInput(20, 20), ioutil.Discard)
+				Ω(err).ShouldNot(HaveOccurred())
+			}()
+		}
+		for i := 0; i < 3; i++ {
+			<-done
+		}
+		Ω(client.Peak()).Should(Equal(2))
+	})
+
+	Context("with duplicate account ids", func() {
+		var r io.Reader
+
+		BeforeEach(func() {
+			r = getReader([][]string{
+				{"Account ID", "Account Name", "First Name", "Created On"},
+				{"1", "jdoe", "Jane", "2020-01-01"},
+				{"2", "bdole", "Bob", "2020-02-02"},
+				{"1", "jdoe", "", "2020-03-03"},
+				{"01", "jdoe", "Janet", ""},
+			})
+		})
+
+		expectLookups := func() {
+			client.On("GetAccount", mockCtx, mock.AnythingOfType("*account.GetAccountRequest")).
+				Return(func(_ context.Context, req *GetAccountRequest) *Account {
+					if req.AccountId == "2" {
+						return &Account{AccountId: 2, Status: "great", CreatedOn: "2019-11-11"}
+					}
+					return &Account{AccountId: 1, Status: "good", CreatedOn: "2019-12-12"}
+				}, nil)
+		}
+
+		It("should share concurrent lookups for the same account id", func() {
+			client.On("GetAccount", mockCtx, &GetAccountRequest{AccountId: "1"}).
+				After(50*time.Millisecond).
+				Return(&Account{AccountId: 1, Status: "good", CreatedOn: "2019-12-12"}, nil).
+				Once()
+			client.On("GetAccount", mockCtx, &GetAccountRequest{AccountId: "2"}).
+				Return(&Account{AccountId: 2, Status: "great", CreatedOn: "2019-11-11"}, nil).
+				Once()
+
+			w := &bytes.Buffer{}
+			sum, err := streamer.Run(ctx, r, w)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(sum.Duplicates).Should(BeEquivalentTo(2))
+
+			assertWriter(w.Bytes(), [][]string{
+				{"1", "Jane", "2020-01-01", "good", "2019-12-12"},
+				{"2", "Bob", "2020-02-02", "great", "2019-11-11"},
+				{"1", "", "2020-03-03", "good", "2019-12-12"},
+				{"01", "Janet", "", "good", "2019-12-12"},
+			})
+		})
+
+		It("should keep the first row", func() {
+			streamer = NewWPStreamer(client, WithDedupePolicy(DedupeKeepFirst))
+			expectLookups()
+
+			w := &bytes.Buffer{}
+			sum, err := streamer.Run(ctx, r, w)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(*sum).Should(Equal(Summary{Rows: 4, Duplicates: 2, Written: 2}))
+			client.AssertNumberOfCalls(T, "GetAccount", 2)
+
+			assertWriter(w.Bytes(), [][]string{
+				{"1", "Jane", "2020-01-01", "good", "2019-12-12"},
+				{"2", "Bob", "2020-02-02", "great", "2019-11-11"},
+			})
+		})
+
+		It("should keep the last row", func() {
+			streamer = NewWPStreamer(client, WithDedupePolicy(DedupeKeepLast))
+			expectLookups()
+
+			w := &bytes.Buffer{}
+			sum, err := streamer.Run(ctx, r, w)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(*sum).Should(Equal(Summary{Rows: 4, Duplicates: 2, Written: 2}))
+
+			assertWriter(w.Bytes(), [][]string{
+				{"01", "Janet", "", "good", "2019-12-12"},
+				{"2", "Bob", "2020-02-02", "great", "2019-11-11"},
+			})
+		})
+
+		It("should merge the rows", func() {
+			streamer = NewWPStreamer(client, WithDedupePolicy(DedupeMerge))
+			expectLookups()
+
+			w := &bytes.Buffer{}
+			sum, err := streamer.Run(ctx, r, w)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(*sum).Should(Equal(Summary{Rows: 4, Duplicates: 2, Written: 2}))
+
+			assertWriter(w.Bytes(), [][]string{
+				{"01", "Janet", "2020-03-03", "good", "2019-12-12"},
+				{"2", "Bob", "2020-02-02", "great", "2019-11-11"},
+			})
+		})
+	})
+
+	It("should only write the rows that match the filter", func() {
+		f, err := ParseFilter(`status in ("closed", "suspended")`)
+		Ω(err).ShouldNot(HaveOccurred())
+		streamer = NewWPStreamer(client, WithFilter(f), WithExcludeMissing())
+
+		client.On("GetAccount", mockCtx, &GetAccountRequest{AccountId: "1"}).
+			Return(&Account{AccountId: 1, Status: "closed", CreatedOn: "2019-12-12"}, nil)
+		client.On("GetAccount", mockCtx, &GetAccountRequest{AccountId: "2"}).
+			Return(&Account{AccountId: 2, Status: "good", CreatedOn: "2019-11-11"}, nil)
+		client.On("GetAccount", mockCtx, &GetAccountRequest{AccountId: "4"}).
+			Return(nil, errors.New("error"))
+
+		var (
+			r = getReader([][]string{
+				{"Account ID", "Account Name", "First Name", "Created On"},
+				{"1", "jdoe", "Jane", "2020-01-01"},
+				{"2", "bdole", "Bob", "2020-02-02"},
+				{"4", "gknight", "Gladys", "2020-03-03"},
+			})
+
+			w = &bytes.Buffer{}
+		)
+
+		sum, err := streamer.Run(ctx, r, w)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(*sum).Should(Equal(Summary{Rows: 3, Failed: 1, Filtered: 2, Written: 1}))
+
+		assertWriter(w.Bytes(), [][]string{
+			{"1", "Jane", "2020-01-01", "closed", "2019-12-12"},
+		})
+	})
+
+	It("should add computed columns", func() {
+		col, err := ParseColumnDefinition("Label={{upper .FirstName}} ({{.Status}})")
+		Ω(err).ShouldNot(HaveOccurred())
+		streamer = NewWPStreamer(client, WithColumns(col))
+
+		client.On("GetAccount", mockCtx, &GetAccountRequest{AccountId: "1"}).
+			Return(&Account{AccountId: 1, Status: "good", CreatedOn: "2019-12-12"}, nil)
+
+		var (
+			r = getReader([][]string{
+				{"Account ID", "Account Name", "First Name", "Created On"},
+				{"1", "jdoe", "Jane", "2020-01-01"},
+			})
+
+			w = &bytes.Buffer{}
+		)
+
+		err = streamer.Stream(ctx, r, w)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		records, err := csv.NewReader(w).ReadAll()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(records).Should(Equal([][]string{
+			{"Account ID", "First Name", "Created On", "Status", "Status Set On", "Label"},
+			{"1", "Jane", "2020-01-01", "good", "2019-12-12", "JANE (good)"},
+		}))
+	})
+
+	It("should add a column for every server field", func() {
+		streamer = NewWPStreamer(client, WithAllServerFields())
+
+		client.On("GetAccount", mockCtx, &GetAccountRequest{AccountId: "1"}).
+			Return(nil, errors.New("error"))
+		client.On("GetAccount", mockCtx, &GetAccountRequest{AccountId: "2"}).
+			Return(&Account{
+				AccountId: 2,
+				Status:    "great",
+				CreatedOn: "2019-11-11",
+				Extra: map[string]json.RawMessage{
+					"plan": json.RawMessage(`{"name": "growth"}`),
+				},
+			}, nil)
+
+		var (
+			r = getReader([][]string{
+				{"Account ID", "Account Name", "First Name", "Created On"},
+				{"1", "jdoe", "Jane", "2020-01-01"},
+				{"2", "bdole", "Bob", "2020-02-02"},
+			})
+
+			w = &bytes.Buffer{}
+		)
+
+		err := streamer.Stream(ctx, r, w)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		records, err := csv.NewReader(w).ReadAll()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(records[0]).Should(Equal([]string{"Account ID", "First Name", "Created On", "Status", "Status Set On", "plan.name"}))
+		Ω(records[1:]).Should(ConsistOf([][]string{
+			{"1", "Jane", "2020-01-01", "", "", ""},
+			{"2", "Bob", "2020-02-02", "great", "2019-11-11", "growth"},
+		}))
+	})
 })
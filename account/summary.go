@@ -0,0 +1,30 @@
+package account
+
+import "sync/atomic"
+
+// Summary tallies what happened to the rows during a run.  Counters are updated
+// atomically since rows are processed concurrently.
+type Summary struct {
+	// Rows is the number of rows read from the input, not including the header
+	Rows int64
+	// Invalid is the number of rows rejected by validation
+	Invalid int64
+	// Duplicates is the number of rows whose account id was already seen
+	Duplicates int64
+	// Failed is the number of rows that could not be looked up on the server
+	Failed int64
+	// Filtered is the number of rows left out of the output by the filter
+	Filtered int64
+	// Written is the number of rows written to the output
+	Written int64
+}
+
+// Add combines the counts from another summary into this one
+func (sum *Summary) Add(other *Summary) {
+	atomic.AddInt64(&sum.Rows, atomic.LoadInt64(&other.Rows))
+	atomic.AddInt64(&sum.Invalid, atomic.LoadInt64(&other.Invalid))
+	atomic.AddInt64(&sum.Duplicates, atomic.LoadInt64(&other.Duplicates))
+	atomic.AddInt64(&sum.Failed, atomic.LoadInt64(&other.Failed))
+	atomic.AddInt64(&sum.Filtered, atomic.LoadInt64(&other.Filtered))
+	atomic.AddInt64(&sum.Written, atomic.LoadInt64(&other.Written))
+}
@@ -0,0 +1,121 @@
+package account
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+)
+
+// ErrPinMismatch is returned when none of the server's certificates match a
+// pinned key
+var ErrPinMismatch = errors.New("server certificate does not match a pinned key")
+
+// WithRootCAs returns a WPClientOption that trusts the certificate authorities
+// in pool instead of the system ones
+func WithRootCAs(pool *x509.CertPool) WPClientOption {
+	return func(c *WPClient) {
+		c.config.tls.rootCAs = pool
+	}
+}
+
+// WithClientCertificate returns a WPClientOption that presents cert to servers
+// that ask for one
+func WithClientCertificate(cert tls.Certificate) WPClientOption {
+	return func(c *WPClient) {
+		c.config.tls.certificates = append(c.config.tls.certificates, cert)
+	}
+}
+
+// WithMinTLSVersion returns a WPClientOption that refuses to talk to servers
+// that can't do at least version v, e.g. tls.VersionTLS12
+func WithMinTLSVersion(v uint16) WPClientOption {
+	return func(c *WPClient) {
+		c.config.tls.minVersion = v
+	}
+}
+
+// WithServerName returns a WPClientOption that checks the server certificate
+// against name rather than the host in the address.  This is for servers that
+// are reached through an address their certificate doesn't cover.
+func WithServerName(name string) WPClientOption {
+	return func(c *WPClient) {
+		c.config.tls.serverName = name
+	}
+}
+
+// WithPinnedKeys returns a WPClientOption that only trusts a server whose
+// certificate chain has one of the public keys.  The pins are base64 encoded
+// sha256 hashes of the subject public key info, as made by SPKIFingerprint.
+// The chain still has to be trusted as usual.
+func WithPinnedKeys(pins ...string) WPClientOption {
+	return func(c *WPClient) {
+		if c.config.tls.pins == nil {
+			c.config.tls.pins = make(map[string]struct{})
+		}
+		for _, pin := range pins {
+			c.config.tls.pins[pin] = struct{}{}
+		}
+	}
+}
+
+// SPKIFingerprint returns the pin for the certificate's public key
+func SPKIFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// LoadCAFile reads a bundle of pem encoded certificates for WithRootCAs
+func LoadCAFile(file string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read CA file")
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.Errorf("no certificates found in `%s`", file)
+	}
+	return pool, nil
+}
+
+// tlsConfig collects the TLS options
+type tlsConfig struct {
+	rootCAs      *x509.CertPool
+	certificates []tls.Certificate
+	minVersion   uint16
+	serverName   string
+	pins         map[string]struct{}
+}
+
+// config builds the tls.Config, or returns nil to keep the defaults
+func (cfg tlsConfig) config() *tls.Config {
+	if cfg.rootCAs == nil && cfg.certificates == nil && cfg.minVersion == 0 &&
+		cfg.serverName == "" && cfg.pins == nil {
+		return nil
+	}
+	tc := &tls.Config{
+		RootCAs:      cfg.rootCAs,
+		Certificates: cfg.certificates,
+		MinVersion:   cfg.minVersion,
+		ServerName:   cfg.serverName,
+	}
+	if cfg.pins != nil {
+		tc.VerifyPeerCertificate = cfg.verifyPins
+	}
+	return tc
+}
+
+// verifyPins runs after the usual checks, so the chains have been verified
+func (cfg tlsConfig) verifyPins(_ [][]byte, chains [][]*x509.Certificate) error {
+	for _, chain := range chains {
+		for _, cert := range chain {
+			if _, ok := cfg.pins[SPKIFingerprint(cert)]; ok {
+				return nil
+			}
+		}
+	}
+	return ErrPinMismatch
+}
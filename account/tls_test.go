@@ -0,0 +1,142 @@
+package account_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/wpe_merge/wpe_merge/account"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// newClientCertificate makes a self signed certificate for client auth
+func newClientCertificate() (tls.Certificate, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Ω(err).ShouldNot(HaveOccurred())
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "wpe_merge"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	Ω(err).ShouldNot(HaveOccurred())
+	cert, err := x509.ParseCertificate(der)
+	Ω(err).ShouldNot(HaveOccurred())
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}, cert
+}
+
+var _ = Describe("WPClient TLS", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+
+		svr     *WPEmulator
+		svrCfg  *tls.Config
+		rootCAs *x509.CertPool
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		svrCfg = &tls.Config{}
+	})
+
+	// start has to be called by each spec once svrCfg is set up
+	start := func() {
+		svr = NewTLSWPEmulator(svrCfg)
+		svr.LoadData(&Account{AccountId: 1, Status: "good", CreatedOn: "2011-01-01"})
+		rootCAs = x509.NewCertPool()
+		rootCAs.AddCert(svr.Certificate())
+	}
+
+	AfterEach(func() {
+		cancel()
+		if svr != nil {
+			svr.Close()
+			svr = nil
+		}
+	})
+
+	getAccount := func(ops ...WPClientOption) error {
+		_, err := NewWPClient(svr.URL(), ops...).GetAccount(ctx, &GetAccountRequest{AccountId: "1"})
+		return err
+	}
+
+	It("should not trust a private CA by default", func() {
+		start()
+		Ω(getAccount()).ShouldNot(Succeed())
+		Ω(getAccount(WithRootCAs(rootCAs))).Should(Succeed())
+	})
+
+	It("should load the CA from a file", func() {
+		start()
+		dir, err := ioutil.TempDir("", "tls")
+		Ω(err).ShouldNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		file := filepath.Join(dir, "ca.pem")
+		data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: svr.Certificate().Raw})
+		Ω(ioutil.WriteFile(file, data, 0600)).Should(Succeed())
+
+		pool, err := LoadCAFile(file)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(getAccount(WithRootCAs(pool))).Should(Succeed())
+
+		Ω(ioutil.WriteFile(file, []byte("not a cert"), 0600)).Should(Succeed())
+		_, err = LoadCAFile(file)
+		Ω(err).Should(HaveOccurred())
+	})
+
+	It("should present a client certificate", func() {
+		cert, leaf := newClientCertificate()
+		svrCfg.ClientAuth = tls.RequireAndVerifyClientCert
+		svrCfg.ClientCAs = x509.NewCertPool()
+		svrCfg.ClientCAs.AddCert(leaf)
+		start()
+
+		Ω(getAccount(WithRootCAs(rootCAs))).ShouldNot(Succeed())
+		Ω(getAccount(WithRootCAs(rootCAs), WithClientCertificate(cert))).Should(Succeed())
+	})
+
+	It("should refuse servers below the minimum version", func() {
+		svrCfg.MaxVersion = tls.VersionTLS12
+		start()
+
+		Ω(getAccount(WithRootCAs(rootCAs), WithMinTLSVersion(tls.VersionTLS12))).Should(Succeed())
+		Ω(getAccount(WithRootCAs(rootCAs), WithMinTLSVersion(tls.VersionTLS13))).ShouldNot(Succeed())
+	})
+
+	It("should check the certificate against the server name", func() {
+		start()
+		// the test certificate is for example.com
+		Ω(getAccount(WithRootCAs(rootCAs), WithServerName("example.com"))).Should(Succeed())
+		Ω(getAccount(WithRootCAs(rootCAs), WithServerName("wpengine.invalid"))).ShouldNot(Succeed())
+	})
+
+	It("should only trust pinned keys", func() {
+		start()
+		pin := SPKIFingerprint(svr.Certificate())
+		Ω(getAccount(WithRootCAs(rootCAs), WithPinnedKeys("bm90IGEgcGlu", pin))).Should(Succeed())
+
+		err := getAccount(WithRootCAs(rootCAs), WithPinnedKeys("bm90IGEgcGlu"))
+		Ω(err).Should(HaveOccurred())
+		Ω(errors.Is(err, ErrPinMismatch)).Should(BeTrue())
+	})
+})
@@ -0,0 +1,169 @@
+package account
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// DefaultUserAgent is sent with every request unless WithUserAgent says
+// otherwise
+const DefaultUserAgent = "wpe_merge"
+
+// WPClientOption is an option that can be passed into the WPClient
+type WPClientOption func(c *WPClient)
+
+// WithRequestTimeout returns a WPClientOption that gives up on an http request
+// that takes longer than d, including reading the response.  Without it, a
+// hung connection can hold on to a request slot forever.
+func WithRequestTimeout(d time.Duration) WPClientOption {
+	return func(c *WPClient) {
+		c.config.requestTimeout = d
+	}
+}
+
+// WithCallTimeout returns a WPClientOption that limits how long a call to the
+// client can take overall.  This matters for calls that make several requests,
+// like GetAccountsByIDs when the server has no bulk endpoint.
+func WithCallTimeout(d time.Duration) WPClientOption {
+	return func(c *WPClient) {
+		c.config.callTimeout = d
+	}
+}
+
+// WithRoundTripper returns a WPClientOption that sends the requests through rt.
+// The options that tune the transport, like WithMaxConns, WithProxy and the TLS
+// options, don't apply to a custom RoundTripper.
+func WithRoundTripper(rt http.RoundTripper) WPClientOption {
+	return func(c *WPClient) {
+		c.config.roundTripper = rt
+	}
+}
+
+// WithMaxConns returns a WPClientOption that sizes the connection pool.  It
+// should match the number of concurrent requests, so that connections are
+// reused rather than opened and thrown away.
+func WithMaxConns(n int) WPClientOption {
+	return func(c *WPClient) {
+		c.config.maxConns = n
+	}
+}
+
+// WithKeepAlive returns a WPClientOption that sets how often idle connections
+// are probed to keep them open.  A negative duration turns off keep-alives, so
+// every request opens a new connection.
+func WithKeepAlive(d time.Duration) WPClientOption {
+	return func(c *WPClient) {
+		c.config.keepAlive = d
+	}
+}
+
+// WithIdleConnTimeout returns a WPClientOption that closes connections that
+// haven't been used for d
+func WithIdleConnTimeout(d time.Duration) WPClientOption {
+	return func(c *WPClient) {
+		c.config.idleConnTimeout = d
+	}
+}
+
+// WithProxy returns a WPClientOption that sends the requests through an http
+// proxy.  Without it, the proxy comes from the HTTP_PROXY and HTTPS_PROXY
+// environment variables.
+func WithProxy(proxy *url.URL) WPClientOption {
+	return func(c *WPClient) {
+		c.config.proxy = proxy
+	}
+}
+
+// WithUserAgent returns a WPClientOption that sets the User-Agent header
+func WithUserAgent(ua string) WPClientOption {
+	return func(c *WPClient) {
+		c.config.userAgent = ua
+	}
+}
+
+// transportConfig collects the options that shape the http client
+type transportConfig struct {
+	requestTimeout  time.Duration
+	callTimeout     time.Duration
+	roundTripper    http.RoundTripper
+	maxConns        int
+	keepAlive       time.Duration
+	idleConnTimeout time.Duration
+	proxy           *url.URL
+	userAgent       string
+	tls             tlsConfig
+	recording       io.Writer
+}
+
+func defaultTransportConfig() transportConfig {
+	return transportConfig{
+		keepAlive:       30 * time.Second,
+		idleConnTimeout: 90 * time.Second,
+		userAgent:       DefaultUserAgent,
+	}
+}
+
+// client builds the http client.  Every WPClient gets its own, so that clients
+// with different options don't step on each other.
+func (cfg transportConfig) client() *http.Client {
+	rt := cfg.roundTripper
+	if rt == nil {
+		rt = cfg.transport()
+	}
+	if cfg.recording != nil {
+		rt = NewRecorder(rt, cfg.recording)
+	}
+	return &http.Client{
+		Transport: rt,
+		Timeout:   cfg.requestTimeout,
+	}
+}
+
+func (cfg transportConfig) transport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: cfg.keepAlive,
+	}
+	t.DialContext = dialer.DialContext
+	t.DisableKeepAlives = cfg.keepAlive < 0
+	t.IdleConnTimeout = cfg.idleConnTimeout
+	if cfg.maxConns > 0 {
+		t.MaxConnsPerHost = cfg.maxConns
+		t.MaxIdleConnsPerHost = cfg.maxConns
+		if t.MaxIdleConns < cfg.maxConns {
+			t.MaxIdleConns = cfg.maxConns
+		}
+	}
+	if cfg.proxy != nil {
+		t.Proxy = http.ProxyURL(cfg.proxy)
+	}
+	if tc := cfg.tls.config(); tc != nil {
+		t.TLSClientConfig = tc
+	}
+	return t
+}
+
+// newRequest creates a request with the headers every request needs
+func (c *WPClient) newRequest(ctx context.Context, method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if c.config.userAgent != "" {
+		req.Header.Set("User-Agent", c.config.userAgent)
+	}
+	return req, nil
+}
+
+// withTimeout applies the call timeout to the context, if there is one
+func (c *WPClient) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.config.callTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, c.config.callTimeout)
+}
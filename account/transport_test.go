@@ -0,0 +1,132 @@
+package account_test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	. "github.com/wpe_merge/wpe_merge/account"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// roundTripperFunc lets a function stand in for a RoundTripper
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+var _ = Describe("WPClient transport", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+
+		svr      *httptest.Server
+		handler  http.HandlerFunc
+		requests []*http.Request
+		conns    int64
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		requests = nil
+		conns = 0
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(&Account{AccountId: 1, Status: "good"})
+		}
+
+		svr = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, r)
+			handler(w, r)
+		}))
+		svr.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+			if state == http.StateNew {
+				atomic.AddInt64(&conns, 1)
+			}
+		}
+		svr.Start()
+	})
+
+	AfterEach(func() {
+		cancel()
+		svr.Close()
+	})
+
+	getAccount := func(client *WPClient) error {
+		_, err := client.GetAccount(ctx, &GetAccountRequest{AccountId: "1"})
+		return err
+	}
+
+	It("should send the user agent", func() {
+		Ω(getAccount(NewWPClient(svr.URL))).Should(Succeed())
+		Ω(requests[0].UserAgent()).Should(Equal(DefaultUserAgent))
+
+		Ω(getAccount(NewWPClient(svr.URL, WithUserAgent("reports/1.0")))).Should(Succeed())
+		Ω(requests[1].UserAgent()).Should(Equal("reports/1.0"))
+	})
+
+	It("should give up on a request that takes too long", func() {
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(200 * time.Millisecond)
+		}
+		err := getAccount(NewWPClient(svr.URL, WithRequestTimeout(20*time.Millisecond)))
+		Ω(err).Should(HaveOccurred())
+		Ω(IsNotFound(err)).Should(BeFalse())
+	})
+
+	It("should give up on a call that takes too long", func() {
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == BulkAccountsEndpoint {
+				http.NotFound(w, r)
+				return
+			}
+			time.Sleep(50 * time.Millisecond)
+			json.NewEncoder(w).Encode(&Account{AccountId: 1, Status: "good"})
+		}
+		// without a bulk endpoint, each account is another request
+		client := NewWPClient(svr.URL, WithFanOut(1), WithCallTimeout(120*time.Millisecond))
+		_, err := client.GetAccountsByIDs(ctx, []string{"1", "2", "3", "4"})
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(ContainSubstring("context deadline exceeded"))
+	})
+
+	It("should send requests through a custom round tripper", func() {
+		var calls int64
+		rt := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			atomic.AddInt64(&calls, 1)
+			return http.DefaultTransport.RoundTrip(req)
+		})
+		Ω(getAccount(NewWPClient(svr.URL, WithRoundTripper(rt)))).Should(Succeed())
+		Ω(calls).Should(BeEquivalentTo(1))
+	})
+
+	It("should send requests through a proxy", func() {
+		proxy, err := url.Parse(svr.URL)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		client := NewWPClient("http://wpengine.invalid/", WithProxy(proxy))
+		Ω(getAccount(client)).Should(Succeed())
+		Ω(requests[0].Host).Should(Equal("wpengine.invalid"))
+	})
+
+	It("should reuse connections unless keep-alives are off", func() {
+		client := NewWPClient(svr.URL)
+		for i := 0; i < 3; i++ {
+			Ω(getAccount(client)).Should(Succeed())
+		}
+		Ω(atomic.LoadInt64(&conns)).Should(BeEquivalentTo(1))
+
+		client = NewWPClient(svr.URL, WithKeepAlive(-1))
+		for i := 0; i < 3; i++ {
+			Ω(getAccount(client)).Should(Succeed())
+		}
+		Ω(atomic.LoadInt64(&conns)).Should(BeEquivalentTo(4))
+	})
+})
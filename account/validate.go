@@ -0,0 +1,181 @@
+package account
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ValidationError describes why an input row was rejected
+type ValidationError struct {
+	Field  string
+	Value  string
+	Reason string
+}
+
+func (err ValidationError) Error() string {
+	return fmt.Sprintf("%s `%s` %s", err.Field, err.Value, err.Reason)
+}
+
+// Rule checks a single input record and returns a ValidationError if the
+// record should be rejected
+type Rule interface {
+	Validate(InRecord) error
+}
+
+// RuleFunc lets an ordinary function be used as a Rule
+type RuleFunc func(InRecord) error
+
+// Validate calls f(r)
+func (f RuleFunc) Validate(r InRecord) error {
+	return f(r)
+}
+
+// Validator runs input records through a set of rules before we spend an http
+// request on them
+type Validator struct {
+	rules []Rule
+}
+
+// NewValidator instantiates a new Validator
+func NewValidator(rules ...Rule) *Validator {
+	return &Validator{rules: rules}
+}
+
+// Validate returns the error from the first rule the record breaks
+func (v *Validator) Validate(r InRecord) error {
+	for _, rule := range v.rules {
+		if err := rule.Validate(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DefaultRules are the rules every record should pass: a positive integer
+// account id, a first name and no field longer than maxLength.
+func DefaultRules(maxLength int) []Rule {
+	rules := []Rule{
+		AccountIdRule(),
+		RequiredRule("First Name"),
+	}
+	if maxLength > 0 {
+		for _, field := range inHeader {
+			rules = append(rules, MaxLengthRule(field, maxLength))
+		}
+	}
+	return rules
+}
+
+// AccountIdRule rejects records whose account id is not a positive integer
+func AccountIdRule() Rule {
+	return RuleFunc(func(r InRecord) error {
+		n, err := strconv.Atoi(r.AccountId())
+		if err != nil || n <= 0 {
+			return ValidationError{
+				Field:  inHeader[inAccountId],
+				Value:  r.AccountId(),
+				Reason: "must be a positive integer",
+			}
+		}
+		return nil
+	})
+}
+
+// RequiredRule rejects records where the field is blank
+func RequiredRule(field string) Rule {
+	i := mustFieldIndex(field)
+	return RuleFunc(func(r InRecord) error {
+		if strings.TrimSpace(r[i]) == "" {
+			return ValidationError{
+				Field:  inHeader[i],
+				Value:  r[i],
+				Reason: "is required",
+			}
+		}
+		return nil
+	})
+}
+
+// MaxLengthRule rejects records where the field is longer than n characters
+func MaxLengthRule(field string, n int) Rule {
+	i := mustFieldIndex(field)
+	return RuleFunc(func(r InRecord) error {
+		if len([]rune(r[i])) > n {
+			return ValidationError{
+				Field:  inHeader[i],
+				Value:  r[i],
+				Reason: fmt.Sprintf("is longer than %d characters", n),
+			}
+		}
+		return nil
+	})
+}
+
+// PatternRule rejects records where the field does not match the pattern.  The
+// message is used as the reason in the error, if provided.
+func PatternRule(field string, pattern *regexp.Regexp, message string) Rule {
+	i := mustFieldIndex(field)
+	if message == "" {
+		message = fmt.Sprintf("does not match `%s`", pattern)
+	}
+	return RuleFunc(func(r InRecord) error {
+		if !pattern.MatchString(r[i]) {
+			return ValidationError{
+				Field:  inHeader[i],
+				Value:  r[i],
+				Reason: message,
+			}
+		}
+		return nil
+	})
+}
+
+// DuplicateRule rejects any record whose account id has already been seen by
+// the rule.  The rule remembers every id it sees, so use a new one for each
+// batch of input that should be checked on its own.  With WithParallelRead,
+// whichever row gets checked first is kept, which may not be the first one in
+// the input.
+func DuplicateRule() Rule {
+	var (
+		mu   sync.Mutex
+		seen = make(map[string]bool)
+	)
+	return RuleFunc(func(r InRecord) error {
+		accountId := normalizeAccountId(r.AccountId())
+
+		mu.Lock()
+		defer mu.Unlock()
+		if seen[accountId] {
+			return ValidationError{
+				Field:  inHeader[inAccountId],
+				Value:  r.AccountId(),
+				Reason: "is a duplicate",
+			}
+		}
+		seen[accountId] = true
+		return nil
+	})
+}
+
+// FieldIndex returns the column of the named input field
+func FieldIndex(field string) (int, error) {
+	for i, header := range inHeader {
+		if strings.EqualFold(header, field) {
+			return i, nil
+		}
+	}
+	return 0, errors.Errorf("unknown field `%s`", field)
+}
+
+func mustFieldIndex(field string) int {
+	i, err := FieldIndex(field)
+	if err != nil {
+		panic(err.Error())
+	}
+	return i
+}
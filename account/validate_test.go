@@ -0,0 +1,51 @@
+package account_test
+
+import (
+	"regexp"
+
+	. "github.com/wpe_merge/wpe_merge/account"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Validator", func() {
+	DescribeTable("default rules",
+		func(record InRecord, reason string) {
+			err := NewValidator(DefaultRules(10)...).Validate(record)
+			if reason == "" {
+				Ω(err).ShouldNot(HaveOccurred())
+				return
+			}
+			Ω(err).Should(BeAssignableToTypeOf(ValidationError{}))
+			Ω(err.(ValidationError).Reason).Should(Equal(reason))
+		},
+		Entry("a valid row", InRecord{"1", "jdoe", "Jane", "2020-01-01"}, ""),
+		Entry("a non-numeric account id", InRecord{"a1", "jdoe", "Jane", "2020-01-01"}, "must be a positive integer"),
+		Entry("a negative account id", InRecord{"-1", "jdoe", "Jane", "2020-01-01"}, "must be a positive integer"),
+		Entry("a zero account id", InRecord{"0", "jdoe", "Jane", "2020-01-01"}, "must be a positive integer"),
+		Entry("a blank first name", InRecord{"1", "jdoe", " ", "2020-01-01"}, "is required"),
+		Entry("a long account name", InRecord{"1", "jdoe-the-third", "Jane", "2020-01-01"}, "is longer than 10 characters"),
+	)
+
+	It("should reject duplicate account ids", func() {
+		v := NewValidator(DuplicateRule())
+		Ω(v.Validate(InRecord{"1", "jdoe", "Jane", "2020-01-01"})).Should(Succeed())
+		Ω(v.Validate(InRecord{"2", "bdole", "Bob", "2020-02-02"})).Should(Succeed())
+		Ω(v.Validate(InRecord{"01", "jdoe", "Jane", "2020-01-01"})).ShouldNot(Succeed())
+	})
+
+	It("should reject rows that don't match a pattern", func() {
+		v := NewValidator(PatternRule("account name", regexp.MustCompile(`^[a-z]+$`), "must be lowercase"))
+		Ω(v.Validate(InRecord{"1", "jdoe", "Jane", "2020-01-01"})).Should(Succeed())
+
+		err := v.Validate(InRecord{"1", "JDoe", "Jane", "2020-01-01"})
+		Ω(err).Should(MatchError("Account Name `JDoe` must be lowercase"))
+	})
+
+	It("should return an error for an unknown field", func() {
+		_, err := FieldIndex("Last Name")
+		Ω(err).Should(HaveOccurred())
+	})
+})
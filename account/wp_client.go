@@ -1,49 +1,91 @@
 package account
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"net/http"
 	"net/url"
 	"path"
+	"strconv"
+	"sync"
+	"sync/atomic"
 
 	"github.com/pkg/errors"
+	"golang.org/x/sync/semaphore"
 )
 
-var httpClient = http.DefaultClient
-
 const (
-	AccountsEndpoint = "/v1/accounts"
+	AccountsEndpoint     = "/v1/accounts"
+	BulkAccountsEndpoint = "/v1/accounts/bulk"
 )
 
+// WithFanOut returns a WPClientOption that limits the number of requests
+// GetAccountsByIDs makes at a time when the server doesn't have a bulk
+// endpoint
+func WithFanOut(n int64) WPClientOption {
+	if n <= 0 {
+		panic("fan out must be greater than 0")
+	}
+	return func(c *WPClient) {
+		c.fanOut = n
+	}
+}
+
 // WPClient is the connector to the wpengine server that implements client
 type WPClient struct {
-	url *url.URL
+	url    *url.URL
+	fanOut int64
+	http   *http.Client
+	config transportConfig
+
+	// noBulk is set once we find out the server doesn't have a bulk endpoint
+	noBulk int32
 }
 
 var _ Client = &WPClient{}
 
 // NewWPClient instantiates a new client
-func NewWPClient(addr string) *WPClient {
+func NewWPClient(addr string, ops ...WPClientOption) *WPClient {
 	url, err := url.Parse(addr)
 	if err != nil {
 		panic("invalid address")
 	}
-	return &WPClient{url}
+	c := &WPClient{
+		url:    url,
+		fanOut: 10, // Default
+		config: defaultTransportConfig(),
+	}
+	for _, op := range ops {
+		op(c)
+	}
+	c.http = c.config.client()
+	return c
 }
 
 func (c *WPClient) GetAccounts(ctx context.Context, req *GetAccountsRequest) (*GetAccountsResponse, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
 	// make a request to the server
 	url, err := c.url.Parse(AccountsEndpoint)
 	if err != nil {
 		// This should not happen
 		panic("could not load endpoint")
 	}
-	httpReq, err := http.NewRequestWithContext(ctx, "GET", url.String(), nil)
+	query := url.Query()
+	if req.Page > 0 {
+		query.Set("page", strconv.Itoa(req.Page))
+	}
+	if req.PageSize > 0 {
+		query.Set("page_size", strconv.Itoa(req.PageSize))
+	}
+	url.RawQuery = query.Encode()
+	httpReq, err := c.newRequest(ctx, "GET", url.String(), nil)
 	if err != nil {
 		return nil, errors.Wrap(err, "could not create request")
 	}
-	httpResp, err := httpClient.Do(httpReq)
+	httpResp, err := c.http.Do(httpReq)
 	if err != nil {
 		return nil, errors.Wrap(err, "could not connect to the server")
 	}
@@ -57,7 +99,8 @@ func (c *WPClient) GetAccounts(ctx context.Context, req *GetAccountsRequest) (*G
 		if err := dec.Decode(&respErr); err != nil {
 			return nil, errors.Wrap(err, "could not decode response from the server")
 		}
-		return nil, errors.Wrap(err, "could not look up accounts")
+		respErr.StatusCode = httpResp.StatusCode
+		return nil, errors.Wrap(respErr, "could not look up accounts")
 	}
 	var resp GetAccountsResponse
 	if err := dec.Decode(&resp); err != nil {
@@ -67,18 +110,21 @@ func (c *WPClient) GetAccounts(ctx context.Context, req *GetAccountsRequest) (*G
 }
 
 func (c *WPClient) GetAccount(ctx context.Context, req *GetAccountRequest) (*Account, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
 	// make a request to the server
 	url, err := c.url.Parse(path.Join(AccountsEndpoint, req.AccountId))
 	if err != nil {
 		// This should not happen
 		panic("could not load endpoint")
 	}
-	httpReq, err := http.NewRequestWithContext(ctx, "GET", url.String(), nil)
+	httpReq, err := c.newRequest(ctx, "GET", url.String(), nil)
 	if err != nil {
 		return nil, errors.Wrap(err, "could not create request")
 	}
 
-	httpResp, err := httpClient.Do(httpReq)
+	httpResp, err := c.http.Do(httpReq)
 	if err != nil {
 		return nil, errors.Wrap(err, "could not connect to the server")
 	}
@@ -92,6 +138,7 @@ func (c *WPClient) GetAccount(ctx context.Context, req *GetAccountRequest) (*Acc
 		if err := dec.Decode(&respErr); err != nil {
 			return nil, errors.Wrap(err, "could not decode response from the server")
 		}
+		respErr.StatusCode = httpResp.StatusCode
 		return nil, errors.Wrap(respErr, "could not look up account")
 	}
 	var resp Account
@@ -100,3 +147,122 @@ func (c *WPClient) GetAccount(ctx context.Context, req *GetAccountRequest) (*Acc
 	}
 	return &resp, nil
 }
+
+// errNoBulkEndpoint means the server doesn't know about the bulk endpoint
+var errNoBulkEndpoint = errors.New("no bulk endpoint")
+
+// bulkRequest is the body sent to the bulk endpoint
+type bulkRequest struct {
+	AccountIds []string `json:"account_ids"`
+}
+
+// GetAccountsByIDs looks the accounts up with the bulk endpoint.  Servers
+// advertise the endpoint simply by having it: the first time it comes back as
+// missing, the client switches to looking the accounts up one at a time, a
+// few at once, for good.
+func (c *WPClient) GetAccountsByIDs(ctx context.Context, ids []string) (*GetAccountsResponse, error) {
+	if len(ids) == 0 {
+		return &GetAccountsResponse{Results: []*Account{}}, nil
+	}
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	if atomic.LoadInt32(&c.noBulk) == 0 {
+		resp, err := c.getBulk(ctx, ids)
+		if err != errNoBulkEndpoint {
+			return resp, err
+		}
+		atomic.StoreInt32(&c.noBulk, 1)
+	}
+	return c.getEach(ctx, ids)
+}
+
+func (c *WPClient) getBulk(ctx context.Context, ids []string) (*GetAccountsResponse, error) {
+	// make a request to the server
+	url, err := c.url.Parse(BulkAccountsEndpoint)
+	if err != nil {
+		// This should not happen
+		panic("could not load endpoint")
+	}
+	body, err := json.Marshal(&bulkRequest{AccountIds: ids})
+	if err != nil {
+		return nil, errors.Wrap(err, "could not encode request")
+	}
+	httpReq, err := c.newRequest(ctx, "POST", url.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create request")
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	httpResp, err := c.http.Do(httpReq)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not connect to the server")
+	}
+	defer httpResp.Body.Close()
+	// decode body as json
+	dec := json.NewDecoder(httpResp.Body)
+
+	switch httpResp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return nil, errNoBulkEndpoint
+	default:
+		var respErr ResponseError
+		if err := dec.Decode(&respErr); err != nil {
+			return nil, errors.Wrap(err, "could not decode response from the server")
+		}
+		respErr.StatusCode = httpResp.StatusCode
+		return nil, errors.Wrap(respErr, "could not look up accounts")
+	}
+	var resp GetAccountsResponse
+	if err := dec.Decode(&resp); err != nil {
+		return nil, errors.Wrap(err, "could not decode response from the server")
+	}
+	return &resp, nil
+}
+
+// getEach looks the accounts up one at a time, with up to fanOut requests in
+// flight.  A lookup that fails only fails its own account, which goes in
+// Errors, unless they all fail, in which case the first error is returned.
+func (c *WPClient) getEach(ctx context.Context, ids []string) (*GetAccountsResponse, error) {
+	accounts := make([]*Account, len(ids))
+	errs := make([]error, len(ids))
+	sem := semaphore.NewWeighted(c.fanOut)
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		if err := sem.Acquire(ctx, 1); err != nil {
+			break
+		}
+		wg.Add(1)
+		go func(i int, id string) {
+			defer wg.Done()
+			defer sem.Release(1)
+			acct, err := c.GetAccount(ctx, &GetAccountRequest{AccountId: id})
+			if err != nil && !IsNotFound(err) {
+				errs[i] = err
+				return
+			}
+			accounts[i] = acct
+		}(i, id)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	resp := &GetAccountsResponse{Results: make([]*Account, 0, len(ids))}
+	for i, id := range ids {
+		switch {
+		case errs[i] != nil:
+			if resp.Errors == nil {
+				resp.Errors = make(map[string]error)
+			}
+			resp.Errors[id] = errs[i]
+		case accounts[i] != nil:
+			resp.Results = append(resp.Results, accounts[i])
+		}
+	}
+	if len(ids) > 0 && len(resp.Errors) == len(ids) {
+		return nil, errs[0]
+	}
+	return resp, nil
+}
@@ -2,6 +2,7 @@ package account_test
 
 import (
 	"context"
+	"encoding/json"
 
 	. "github.com/wpe_merge/wpe_merge/account"
 
@@ -89,7 +90,78 @@ var _ = Describe("WpClient", func() {
 				AccountId: "29",
 			})
 			Ω(err).Should(HaveOccurred())
+			Ω(IsNotFound(err)).Should(BeTrue())
 			Ω(resp).Should(BeNil())
 		})
+
+		It("should not treat connection errors as not found", func() {
+			_, err := NewWPClient("http://127.0.0.1:1").GetAccount(ctx, &GetAccountRequest{
+				AccountId: "29",
+			})
+			Ω(err).Should(HaveOccurred())
+			Ω(IsNotFound(err)).Should(BeFalse())
+		})
+
+		It("should look up several accounts with the bulk endpoint", func() {
+			resp, err := client.GetAccountsByIDs(ctx, []string{"1", "29", "2"})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(resp.Results).Should(ConsistOf(accounts))
+
+			bulk, single := emulator.Requests()
+			Ω(bulk).Should(BeEquivalentTo(1))
+			Ω(single).Should(BeZero())
+		})
+
+		It("should look up accounts one at a time if there is no bulk endpoint", func() {
+			emulator.DisableBulk()
+
+			resp, err := client.GetAccountsByIDs(ctx, []string{"1", "29", "2"})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(resp.Results).Should(Equal(accounts))
+
+			// the client remembers that there isn't one
+			_, err = client.GetAccountsByIDs(ctx, []string{"1"})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			bulk, single := emulator.Requests()
+			Ω(bulk).Should(BeEquivalentTo(1))
+			Ω(single).Should(BeEquivalentTo(4))
+		})
+
+		It("should only fail the accounts that failed one at a time", func() {
+			emulator.DisableBulk()
+			emulator.BreakAccounts("2")
+
+			resp, err := client.GetAccountsByIDs(ctx, []string{"1", "29", "2"})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(resp.Results).Should(Equal(accounts[:1]))
+			Ω(resp.Errors).Should(HaveLen(1))
+			Ω(IsNotFound(resp.Errors["2"])).Should(BeFalse())
+		})
+
+		It("should fail the call if every account failed one at a time", func() {
+			emulator.DisableBulk()
+			emulator.BreakAccounts("1", "2")
+
+			_, err := client.GetAccountsByIDs(ctx, []string{"1", "2"})
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("should keep fields it doesn't know about", func() {
+			emulator.LoadData(&Account{
+				AccountId: 3,
+				Status:    "good",
+				CreatedOn: "01/22/2020",
+				Extra: map[string]json.RawMessage{
+					"plan": json.RawMessage(`{"name":"growth"}`),
+				},
+			})
+
+			resp, err := client.GetAccount(ctx, &GetAccountRequest{
+				AccountId: "3",
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(resp.Field("plan.name")).Should(Equal("growth"))
+		})
 	})
 })
@@ -0,0 +1,208 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/wpe_merge/wpe_merge/account"
+)
+
+// Exit codes for the account commands, so that scripts can tell an account
+// that doesn't exist apart from a server that isn't answering
+const (
+	exitNotFound    = 2
+	exitServerError = 3
+)
+
+var (
+	accountOutput   string
+	accountStatuses []string
+)
+
+// exitError ends the program with a particular exit code.  The error has
+// already been logged by the time it is returned.
+type exitError struct {
+	code int
+}
+
+func (e *exitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+// accountCmd groups the commands that look at accounts on the server directly
+var accountCmd = &cobra.Command{
+	Use:   "account",
+	Short: "Looks up accounts on the server",
+	Long: `Looks up accounts on the server, which is handy for checking a single row
+without making a csv file for it.
+
+Exits with 2 if the account doesn't exist and 3 if the server couldn't be
+reached or returned an error.`,
+}
+
+var accountGetCmd = &cobra.Command{
+	Use:   "get <account_id>",
+	Short: "Shows a single account",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("required account_id")
+		}
+		return checkAccountOutput()
+	},
+	PreRun: initContext,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		log := logrus.WithContext(ctx).WithField("account_id", args[0])
+
+		acct, err := client.GetAccount(ctx, &account.GetAccountRequest{AccountId: args[0]})
+		if account.IsNotFound(err) {
+			log.WithError(err).Error("Account not found")
+			return &exitError{code: exitNotFound}
+		} else if err != nil {
+			log.WithError(err).Error("Could not look up account")
+			return &exitError{code: exitServerError}
+		}
+
+		// a single account is written as an object rather than a list
+		if accountOutput == "json" {
+			err = writeJSON(os.Stdout, acct)
+		} else {
+			err = writeAccounts(os.Stdout, accountOutput, []*account.Account{acct})
+		}
+		if err != nil {
+			log.WithError(err).Error("Could not write account")
+			return &exitError{code: 1}
+		}
+		return nil
+	},
+}
+
+var accountListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists the accounts on the server",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 0 {
+			return errors.New("list doesn't take any arguments")
+		}
+		return checkAccountOutput()
+	},
+	PreRun: initContext,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		log := logrus.WithContext(ctx)
+
+		accts, err := account.AllAccounts(ctx, client, 0)
+		if err != nil {
+			log.WithError(err).Error("Could not look up accounts")
+			return &exitError{code: exitServerError}
+		}
+
+		if len(accountStatuses) > 0 {
+			accts = filterStatuses(accts, accountStatuses)
+		}
+
+		if err := writeAccounts(os.Stdout, accountOutput, accts); err != nil {
+			log.WithError(err).Error("Could not write accounts")
+			return &exitError{code: 1}
+		}
+		return nil
+	},
+}
+
+func checkAccountOutput() error {
+	switch accountOutput {
+	case "table", "json", "csv":
+		return nil
+	}
+	return errors.Errorf("unknown output `%s`, expected table, json or csv", accountOutput)
+}
+
+// filterStatuses keeps the accounts with one of the statuses.  Statuses are
+// compared without regard to case.
+func filterStatuses(accts []*account.Account, statuses []string) []*account.Account {
+	var filtered []*account.Account
+	for _, acct := range accts {
+		for _, status := range statuses {
+			if strings.EqualFold(acct.Status, status) {
+				filtered = append(filtered, acct)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// writeAccounts writes the accounts in the format.  Only json includes the
+// fields that don't have a column.
+func writeAccounts(w io.Writer, format string, accts []*account.Account) error {
+	header := []string{"Account ID", "Status", "Created On"}
+	row := func(acct *account.Account) []string {
+		return []string{strconv.Itoa(acct.AccountId), acct.Status, acct.CreatedOn}
+	}
+
+	switch format {
+	case "json":
+		if accts == nil {
+			accts = []*account.Account{}
+		}
+		return writeJSON(w, accts)
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write(header)
+		for _, acct := range accts {
+			cw.Write(row(acct))
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.ToUpper(strings.Join(header, "\t")))
+		for _, acct := range accts {
+			fmt.Fprintln(tw, strings.Join(row(acct), "\t"))
+		}
+		return tw.Flush()
+	}
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func init() {
+	rootCmd.AddCommand(accountCmd)
+	accountCmd.AddCommand(accountGetCmd)
+	accountCmd.AddCommand(accountListCmd)
+
+	accountCmd.PersistentFlags().StringVarP(&accountOutput, "output", "o", "table", "output format: table, json or csv")
+	accountListCmd.Flags().StringSliceVar(&accountStatuses, "status", nil, "only list accounts with this status (can be repeated)")
+
+	// the commands log their own errors and set the exit code
+	for _, cmd := range []*cobra.Command{accountGetCmd, accountListCmd} {
+		cmd.SilenceErrors = true
+		cmd.SilenceUsage = true
+	}
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wpe_merge/wpe_merge/account"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("account command", func() {
+	var (
+		svr    *httptest.Server
+		stdout *os.File
+	)
+
+	BeforeEach(func() {
+		svr = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.URL.Path {
+			case account.AccountsEndpoint:
+				json.NewEncoder(w).Encode(&account.GetAccountsResponse{Results: []*account.Account{
+					{AccountId: 1, Status: "good", CreatedOn: "2011-01-12"},
+				}})
+			case account.AccountsEndpoint + "/1":
+				json.NewEncoder(w).Encode(&account.Account{AccountId: 1, Status: "good", CreatedOn: "2011-01-12"})
+			case account.AccountsEndpoint + "/500":
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(&account.ResponseError{Detail: "Server Error"})
+			default:
+				w.WriteHeader(http.StatusNotFound)
+				json.NewEncoder(w).Encode(&account.ResponseError{Detail: "Not found."})
+			}
+		}))
+
+		// the accounts are written to stdout and the errors logged
+		stdout = os.Stdout
+		devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+		Ω(err).ShouldNot(HaveOccurred())
+		os.Stdout = devNull
+		logrus.SetOutput(GinkgoWriter)
+	})
+
+	AfterEach(func() {
+		os.Stdout.Close()
+		os.Stdout = stdout
+		logrus.SetOutput(os.Stderr)
+		svr.Close()
+	})
+
+	// run runs the command against the server and returns the exit code
+	run := func(url string, args ...string) int {
+		rootCmd.SetArgs(append([]string{"--url", url}, args...))
+		return exitCode(rootCmd.Execute())
+	}
+
+	It("should exit with 0 when the account is found", func() {
+		Ω(run(svr.URL, "account", "get", "1")).Should(Equal(0))
+		Ω(run(svr.URL, "account", "list")).Should(Equal(0))
+	})
+
+	It("should exit with 2 when the account doesn't exist", func() {
+		Ω(run(svr.URL, "account", "get", "2")).Should(Equal(exitNotFound))
+	})
+
+	It("should exit with 3 when the server has an error", func() {
+		Ω(run(svr.URL, "account", "get", "500")).Should(Equal(exitServerError))
+	})
+
+	It("should exit with 3 when the server can't be reached", func() {
+		svr.Close()
+		Ω(run(svr.URL, "account", "get", "1")).Should(Equal(exitServerError))
+		Ω(run(svr.URL, "account", "list")).Should(Equal(exitServerError))
+	})
+
+	It("should exit with 1 when the arguments are wrong", func() {
+		Ω(run(svr.URL, "account", "get")).Should(Equal(1))
+	})
+})
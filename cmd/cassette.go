@@ -0,0 +1,67 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/wpe_merge/wpe_merge/account"
+)
+
+// recording is the cassette being recorded, if there is one
+var recording *os.File
+
+// cassetteOptions sets up recording to or replaying from a cassette
+func cassetteOptions() ([]account.WPClientOption, error) {
+	record, replay := viper.GetString("record"), viper.GetString("replay")
+	switch {
+	case record != "" && replay != "":
+		return nil, errors.New("can't --record and --replay at the same time")
+	case record != "":
+		f, err := os.Create(record)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not create cassette `%s`", record)
+		}
+		recording = f
+		return []account.WPClientOption{account.WithRecording(f)}, nil
+	case replay != "":
+		f, err := os.Open(replay)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not open cassette `%s`", replay)
+		}
+		defer f.Close()
+		replayer, err := account.LoadCassette(f)
+		if err != nil {
+			return nil, err
+		}
+		return []account.WPClientOption{account.WithRoundTripper(replayer)}, nil
+	}
+	return nil, nil
+}
+
+// closeCassette closes the cassette being recorded
+func closeCassette(cmd *cobra.Command, args []string) {
+	if recording == nil {
+		return
+	}
+	if err := recording.Close(); err != nil {
+		logrus.WithError(err).Error("Could not close cassette")
+	}
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("cassettes", func() {
+	var (
+		dir      string
+		cassette string
+		input    string
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "cassette")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		cassette = filepath.Join(dir, "cassette.jsonl")
+		Ω(ioutil.WriteFile(cassette, []byte("keep me\n"), 0644)).Should(Succeed())
+		input = filepath.Join(dir, "input.csv")
+		Ω(ioutil.WriteFile(input, []byte("Account ID,Account Name,First Name,Created On\n1,jdoe,Jane,2020-01-01\n"), 0644)).Should(Succeed())
+
+		logrus.SetOutput(GinkgoWriter)
+	})
+
+	AfterEach(func() {
+		rootCmd.PersistentFlags().Set("record", "")
+		rootCmd.PersistentFlags().Set("source", "")
+		rootCmd.Flags().Set("dry-run", "false")
+		logrus.SetOutput(os.Stderr)
+		os.RemoveAll(dir)
+	})
+
+	// recorded returns what is in the cassette
+	recorded := func() string {
+		b, err := ioutil.ReadFile(cassette)
+		Ω(err).ShouldNot(HaveOccurred())
+		return string(b)
+	}
+
+	It("should leave the cassette alone on a dry run", func() {
+		rootCmd.SetArgs([]string{"--dry-run", "--record", cassette, input})
+		Ω(rootCmd.Execute()).Should(Succeed())
+		Ω(client).Should(BeNil())
+		Ω(recorded()).Should(Equal("keep me\n"))
+	})
+
+	It("should leave the cassette alone when diffing snapshots", func() {
+		rootCmd.SetArgs([]string{"snapshot", "diff", "--record", cassette, filepath.Join(dir, "old"), filepath.Join(dir, "new")})
+		Ω(rootCmd.Execute()).Should(HaveOccurred())
+		Ω(recorded()).Should(Equal("keep me\n"))
+	})
+
+	It("should refuse to record with a snapshot source", func() {
+		rootCmd.SetArgs([]string{"account", "get", "1", "--source", "snapshot:" + filepath.Join(dir, "snapshot"), "--record", cassette})
+		Ω(rootCmd.Execute()).Should(MatchError("--record and --replay don't work with a snapshot --source"))
+		Ω(recorded()).Should(Equal("keep me\n"))
+	})
+})
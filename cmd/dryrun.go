@@ -0,0 +1,66 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/wpe_merge/wpe_merge/account"
+)
+
+// checkInputs reads and validates every input without touching the server or
+// the output
+func checkInputs(inputs []string) (*account.DryRunSummary, error) {
+	total := &account.DryRunSummary{}
+	for _, input := range inputs {
+		sum, err := checkFile(input)
+		total.Add(sum)
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func checkFile(input string) (*account.DryRunSummary, error) {
+	infile, err := os.Open(input)
+	if err != nil {
+		return &account.DryRunSummary{}, errors.Wrapf(err, "could not open file `%s`", input)
+	}
+	defer infile.Close()
+
+	sum, err := streamer.DryRun(ctx, infile)
+	if len(inputs) > 1 {
+		logDryRun(logrus.WithContext(ctx).WithField("file", input), sum)
+	}
+	if err != nil {
+		return sum, errors.Wrapf(err, "could not check `%s`", input)
+	}
+	return sum, nil
+}
+
+func logDryRun(log *logrus.Entry, sum *account.DryRunSummary) {
+	log.WithFields(logrus.Fields{
+		"rows":               sum.Rows,
+		"valid":              sum.Valid,
+		"invalid":            sum.Invalid,
+		"duplicates":         sum.Duplicates,
+		"requests":           sum.Requests,
+		"estimated_duration": sum.Estimate(maxConcurrentRequests, requestLatency).String(),
+	}).Info("Finished checking rows")
+}
@@ -0,0 +1,145 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/wpe_merge/wpe_merge/account"
+	"golang.org/x/sync/errgroup"
+)
+
+// expandInputs resolves any glob patterns in the input arguments.  Arguments
+// without wildcards are passed through, so a missing file is still reported
+// when it is opened.
+func expandInputs(args []string) ([]string, error) {
+	var inputs []string
+	for _, arg := range args {
+		if !strings.ContainsAny(arg, "*?[") {
+			inputs = append(inputs, arg)
+			continue
+		}
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not expand `%s`", arg)
+		}
+		if len(matches) == 0 {
+			return nil, errors.Errorf("no files match `%s`", arg)
+		}
+		inputs = append(inputs, matches...)
+	}
+	return inputs, nil
+}
+
+// mergeInto streams every input, one after the other, into a single output
+// file
+func mergeInto(inputs []string, output string) (*account.Summary, error) {
+	total := &account.Summary{}
+
+	out, err := createOutput(output)
+	if err != nil {
+		return total, err
+	}
+
+	combined := account.NewCombinedWriter(out, sourceColumn)
+	for _, input := range inputs {
+		sum, err := mergeFile(streamer, input, combined.Source(input))
+		total.Add(sum)
+		if err != nil {
+			out.Remove()
+			return total, err
+		}
+	}
+
+	return total, out.Close()
+}
+
+// mergeEach streams every input into its own output file in the directory.
+// Up to --parallel-files inputs are processed at the same time.  Each one is
+// validated on its own, but the limit on concurrent requests applies to all of
+// them together.
+func mergeEach(inputs []string, dir string) (*account.Summary, error) {
+	total := &account.Summary{}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return total, errors.Wrapf(err, "could not create directory `%s`", dir)
+	}
+
+	// make sure two inputs won't write over each other's output
+	outputs := make(map[string]string, len(inputs))
+	for _, input := range inputs {
+		output := filepath.Join(dir, outputName(input))
+		if other, ok := outputs[output]; ok {
+			return total, errors.Errorf("`%s` and `%s` would both be written to `%s`", other, input, output)
+		}
+		outputs[output] = input
+	}
+
+	// every file holds an open input, an output and its buffers, so only
+	// have a few going at once
+	sem := make(chan struct{}, parallelFiles)
+	var g errgroup.Group
+	for output, input := range outputs {
+		output, input := output, input
+		s, err := outputStreamer()
+		if err != nil {
+			g.Wait()
+			return total, err
+		}
+		sem <- struct{}{}
+		g.Go(func() error {
+			defer func() { <-sem }()
+
+			out, err := createOutput(output)
+			if err != nil {
+				return err
+			}
+
+			sum, err := mergeFile(s, input, out)
+			total.Add(sum)
+			if err != nil {
+				out.Remove()
+				return err
+			}
+			return out.Close()
+		})
+	}
+	return total, g.Wait()
+}
+
+// mergeFile streams a single input into the writer
+func mergeFile(s *account.WPStreamer, input string, w account.RecordWriter) (*account.Summary, error) {
+	log := logrus.WithContext(ctx).WithField("file", input)
+
+	infile, err := os.Open(input)
+	if err != nil {
+		return &account.Summary{}, errors.Wrapf(err, "could not open file `%s`", input)
+	}
+	defer infile.Close()
+
+	sum, err := s.RunRecords(ctx, infile, w)
+	if len(inputs) > 1 {
+		logSummary(log, sum)
+	}
+	if err != nil {
+		return sum, errors.Wrapf(err, "could not stream `%s`", input)
+	}
+	return sum, nil
+}
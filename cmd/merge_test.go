@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/wpe_merge/wpe_merge/account"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// foundClient finds every account it is asked for
+type foundClient struct{}
+
+func (foundClient) GetAccounts(ctx context.Context, req *account.GetAccountsRequest) (*account.GetAccountsResponse, error) {
+	return &account.GetAccountsResponse{}, nil
+}
+
+func (foundClient) GetAccount(ctx context.Context, req *account.GetAccountRequest) (*account.Account, error) {
+	id, _ := strconv.Atoi(req.AccountId)
+	return &account.Account{AccountId: id, Status: "good", CreatedOn: "2019-12-12"}, nil
+}
+
+func (c foundClient) GetAccountsByIDs(ctx context.Context, ids []string) (*account.GetAccountsResponse, error) {
+	resp := &account.GetAccountsResponse{}
+	for _, id := range ids {
+		acct, _ := c.GetAccount(ctx, &account.GetAccountRequest{AccountId: id})
+		resp.Results = append(resp.Results, acct)
+	}
+	return resp, nil
+}
+
+var _ = Describe("merging files with their own outputs", func() {
+	var (
+		dir    string
+		in     []string
+		output string
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "merge")
+		Ω(err).ShouldNot(HaveOccurred())
+		output = filepath.Join(dir, "out")
+		Ω(os.Mkdir(output, 0755)).Should(Succeed())
+
+		// both files have account 1, and the first has it twice
+		in = []string{filepath.Join(dir, "a.csv"), filepath.Join(dir, "b.csv")}
+		Ω(ioutil.WriteFile(in[0], []byte("Account ID,Account Name,First Name,Created On\n1,jdoe,Jane,2020-01-01\n1,jdoe,Jane,2020-01-01\n"), 0644)).Should(Succeed())
+		Ω(ioutil.WriteFile(in[1], []byte("Account ID,Account Name,First Name,Created On\n1,jdoe,Jane,2020-01-01\n"), 0644)).Should(Succeed())
+
+		ctx = context.Background()
+		rejectDuplicates = true
+		validator, err := newValidator()
+		Ω(err).ShouldNot(HaveOccurred())
+		streamer = account.NewWPStreamer(foundClient{}, account.WithValidator(validator))
+	})
+
+	AfterEach(func() {
+		rejectDuplicates = false
+		os.RemoveAll(dir)
+	})
+
+	It("should check each output for duplicates on its own with --out-dir", func() {
+		sum, err := mergeEach(in, output)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(sum.Invalid).Should(BeEquivalentTo(1))
+		Ω(sum.Written).Should(BeEquivalentTo(2))
+	})
+
+	It("should check the files in a drop folder on their own", func() {
+		d := newDropFolder(dir, output, 0)
+		for _, input := range in {
+			sum, err := d.merge(input, filepath.Join(output, filepath.Base(input)))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(sum.Written).Should(BeEquivalentTo(1))
+		}
+	})
+
+	It("should check every input against the others with a single output", func() {
+		sum, err := mergeInto(in, filepath.Join(output, "all.csv"))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(sum.Invalid).Should(BeEquivalentTo(2))
+		Ω(sum.Written).Should(BeEquivalentTo(1))
+	})
+})
@@ -0,0 +1,121 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/wpe_merge/wpe_merge/account"
+)
+
+// The formats the output can be written in
+const (
+	outputCSV     = "csv"
+	outputSQLite  = "sqlite"
+	outputParquet = "parquet"
+)
+
+// outputFile is somewhere the streamer can write to that lives on disk.  The
+// output is either closed once the stream is done, or removed if it failed.
+type outputFile interface {
+	account.RecordWriter
+	Close() error
+	Remove() error
+}
+
+// checkOutputFormat makes sure the output flags go together.  The output
+// settings are read through viper so that they can come from the config file
+// too.
+func checkOutputFormat() error {
+	switch format := viper.GetString("output-format"); format {
+	case outputCSV:
+		return nil
+	case outputSQLite, outputParquet:
+		if viper.GetInt64("shard-rows") > 0 || viper.GetInt64("shard-bytes") > 0 {
+			return errors.New("--shard-rows and --shard-bytes only work with csv output")
+		}
+		if format == outputParquet {
+			if _, err := account.ParseParquetCompression(viper.GetString("parquet-compression")); err != nil {
+				return err
+			}
+			if viper.GetInt64("parquet-row-group-size") <= 0 {
+				return errors.New("--parquet-row-group-size must be positive")
+			}
+		}
+		return nil
+	default:
+		return errors.Errorf("unknown output format `%s`, expected csv, sqlite or parquet", format)
+	}
+}
+
+// outputName is the name of the output for an input when each input gets its
+// own, with the extension changed to suit the format
+func outputName(input string) string {
+	name := filepath.Base(input)
+	switch viper.GetString("output-format") {
+	case outputSQLite:
+		return strings.TrimSuffix(name, filepath.Ext(name)) + ".db"
+	case outputParquet:
+		return strings.TrimSuffix(name, filepath.Ext(name)) + ".parquet"
+	}
+	return name
+}
+
+// createOutput opens the output at path in the format picked by the flags
+func createOutput(path string) (outputFile, error) {
+	switch viper.GetString("output-format") {
+	case outputSQLite:
+		return account.NewSQLiteWriter(path,
+			account.WithSQLiteTable(viper.GetString("sqlite-table")),
+			account.WithSQLiteColumnTypes(columnTypes),
+		)
+	case outputParquet:
+		return account.NewParquetWriter(path,
+			account.WithParquetCompression(account.ParquetCompression(viper.GetString("parquet-compression"))),
+			account.WithRowGroupSize(viper.GetInt64("parquet-row-group-size")),
+			account.WithParquetColumnTypes(columnTypes),
+		)
+	}
+	if shardRows, shardBytes := viper.GetInt64("shard-rows"), viper.GetInt64("shard-bytes"); shardRows > 0 || shardBytes > 0 {
+		return account.NewShardWriter(path, shardRows, shardBytes), nil
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not create file `%s`", path)
+	}
+	return &csvFile{Writer: csv.NewWriter(f), f: f}, nil
+}
+
+// csvFile is a plain csv output
+type csvFile struct {
+	*csv.Writer
+	f *os.File
+}
+
+func (c *csvFile) Close() error {
+	return c.f.Close()
+}
+
+func (c *csvFile) Remove() error {
+	c.f.Close()
+	return os.Remove(c.f.Name())
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"bytes"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/viper"
+	"github.com/wpe_merge/wpe_merge/account"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("output", func() {
+	// config reads the settings as if they came from the config file
+	config := func(yaml string) {
+		viper.SetConfigType("yaml")
+		Ω(viper.ReadConfig(bytes.NewBufferString(yaml))).Should(Succeed())
+	}
+
+	AfterEach(func() {
+		config("")
+	})
+
+	It("should default to csv", func() {
+		Ω(checkOutputFormat()).Should(Succeed())
+		Ω(outputName("in/a.csv")).Should(Equal("a.csv"))
+	})
+
+	It("should take every output setting from the config file", func() {
+		config("output-format: sqlite\nsqlite-table: churn\n")
+		Ω(checkOutputFormat()).Should(Succeed())
+		Ω(outputName("in/a.csv")).Should(Equal("a.db"))
+
+		dir, err := ioutil.TempDir("", "output")
+		Ω(err).ShouldNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+		out, err := createOutput(filepath.Join(dir, "a.db"))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(out).Should(BeAssignableToTypeOf(&account.SQLiteWriter{}))
+		Ω(out.Write([]string{"Account ID"})).Should(Succeed())
+		Ω(out.Write([]string{"1"})).Should(Succeed())
+		Ω(out.Close()).Should(Succeed())
+
+		db, err := sql.Open("sqlite3", filepath.Join(dir, "a.db"))
+		Ω(err).ShouldNot(HaveOccurred())
+		defer db.Close()
+		var n int
+		Ω(db.QueryRow(`SELECT COUNT(*) FROM churn`).Scan(&n)).Should(Succeed())
+		Ω(n).Should(Equal(1))
+
+		config("output-format: parquet\nparquet-compression: lzma\n")
+		Ω(checkOutputFormat()).Should(MatchError(ContainSubstring("lzma")))
+		config("output-format: parquet\nparquet-row-group-size: 0\n")
+		Ω(checkOutputFormat()).Should(MatchError("--parquet-row-group-size must be positive"))
+		config("output-format: sqlite\nshard-rows: 10\n")
+		Ω(checkOutputFormat()).Should(MatchError("--shard-rows and --shard-bytes only work with csv output"))
+	})
+})
@@ -0,0 +1,79 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/wpe_merge/wpe_merge/account"
+)
+
+var reconcileStatuses []string
+
+// reconcileCmd reports the accounts that are missing from either side
+var reconcileCmd = &cobra.Command{
+	Use:   "reconcile <input_file> [output_file]",
+	Short: "Lists accounts that are missing from the input file or the server",
+	Long: `Lists the accounts on the server that are missing from the input file, along
+with the input accounts that are missing from the server.  The report is
+written to stdout unless an output file is provided.`,
+	Args: func(cmd *cobra.Command, args []string) (err error) {
+		if len(args) < 1 || len(args) > 2 {
+			return errors.New("required input_file and optional output_file")
+		}
+		return nil
+	},
+	PreRun: initContext,
+	Run: func(cmd *cobra.Command, args []string) {
+		log := logrus.WithContext(ctx)
+
+		infile, err := os.Open(args[0])
+		if err != nil {
+			log.WithError(err).Errorf("Could not open file `%s`", args[0])
+			return
+		}
+		defer infile.Close()
+
+		var w io.Writer = os.Stdout
+		if len(args) == 2 {
+			outfile, err := os.Create(args[1])
+			if err != nil {
+				log.WithError(err).Errorf("Could not create file `%s`", args[1])
+				return
+			}
+			defer outfile.Close()
+			w = outfile
+		}
+
+		reconciler := account.NewReconciler(client, account.WithStatuses(reconcileStatuses...))
+		if err := reconciler.Reconcile(ctx, infile, w); err != nil {
+			log.WithError(err).Error("Could not reconcile accounts")
+			if len(args) == 2 {
+				os.Remove(args[1])
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reconcileCmd)
+
+	reconcileCmd.Flags().StringSliceVar(&reconcileStatuses, "status", nil, "only report server accounts with this status (can be repeated)")
+}
@@ -18,8 +18,12 @@ package cmd
 import (
 	"context"
 	"fmt"
+	neturl "net/url"
 	"os"
 	"os/signal"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -32,76 +36,498 @@ import (
 
 var (
 	cfgFile               string
-	infile, outfile       *os.File
+	inputs                []string
+	output                string
+	outDir                string
+	parallelFiles         int
+	sourceColumn          bool
 	url                   string
 	maxConcurrentRequests int64
+	adaptiveConcurrency   bool
+	adaptiveMin           int64
+	adaptiveMax           int64
+	parallelRead          int
+	batchSize             int
+	fanOut                int64
+	flushRows             int64
+	flushInterval         time.Duration
+	maxMemory             int64
+	dateFormat            string
+	timezone              string
+	errFilename           string
+	errfile               *os.File
+	maxFieldLength        int
+	rejectDuplicates      bool
+	dedupe                string
+	filter                string
+	excludeMissing        bool
+	columns               []string
+	serverFields          []string
+	allServerFields       bool
+	dryRun                bool
+	requestLatency        time.Duration
+	onFailure             string
 
+	client   account.Client
 	streamer *account.WPStreamer
 	ctx      context.Context
+	// columnTypes are the types of the computed columns, for the outputs
+	// that store more than text
+	columnTypes map[string]account.ColumnType
 )
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
-	Use:   "wpe_merge <input_file> <output_file>",
+	Use:   "wpe_merge <input_file>... <output_file>",
 	Short: "Merges input account info with data on the server",
+	Long: `Merges input account info with data on the server.
+
+Several input files (or glob patterns) can be merged in one run.  They are
+written into a single output file, or into one file per input when --out-dir is
+set, in which case every argument is an input.
+
+With --dry-run, the inputs are checked and counted, but nothing is looked up and
+no output is written, so every argument is an input there too.`,
 	Args: func(cmd *cobra.Command, args []string) (err error) {
-		if len(args) != 2 {
-			return errors.New("required input_file and output_file")
+		// a dry run doesn't write anything, so every argument is an input
+		if outDir == "" && !dryRun {
+			if len(args) < 2 {
+				return errors.New("required input_file and output_file")
+			}
+			output = args[len(args)-1]
+			args = args[:len(args)-1]
+		} else if len(args) < 1 {
+			return errors.New("required input_file")
+		}
+		if parallelFiles <= 0 {
+			return errors.New("--parallel-files must be greater than 0")
 		}
 
-		infile, err = os.Open(args[0])
+		inputs, err = expandInputs(args)
 		if err != nil {
-			return errors.Wrapf(err, "could not open file `%s`", args[0])
+			return err
 		}
 
-		outfile, err = os.Create(args[1])
-		if err != nil {
-			infile.Close()
-			return errors.Wrapf(err, "could not create file `%s`", args[1])
+		if errFilename != "" {
+			errfile, err = os.Create(errFilename)
+			if err != nil {
+				return errors.Wrapf(err, "could not create file `%s`", errFilename)
+			}
 		}
 
 		return nil
 	},
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
-		client := account.NewWPClient(url)
-		streamer = account.NewWPStreamer(client, account.WithMaxConcurrentRequests(maxConcurrentRequests))
-	},
-	PreRun: func(cmd *cobra.Command, args []string) {
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithCancel(context.Background())
-		sigCh := make(chan os.Signal, 1)
-		signal.Notify(sigCh, os.Interrupt)
-		go func() {
-			<-sigCh
-			cancel()
-		}()
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// don't connect (or start a cassette) for runs that never look
+		// anything up
+		client = nil
+		if _, offline := cmd.Annotations[offlineAnnotation]; !offline && !dryRun {
+			var err error
+			client, err = newClient()
+			if err != nil {
+				return err
+			}
+		}
+		if addr := viper.GetString("metrics-addr"); addr != "" {
+			if err := serveMetrics(addr); err != nil {
+				return err
+			}
+		}
+
+		if err := checkOutputFormat(); err != nil {
+			return err
+		}
+		ops, err := streamerOptions()
+		if err != nil {
+			return err
+		}
+
+		// Files from different regions are likely to share accounts, so don't
+		// look them up more than once
+		var c account.Client = client
+		if client != nil && len(inputs) > 1 {
+			c = account.NewCachingClient(client)
+		}
+		streamer = account.NewWPStreamer(c, ops...)
+		return nil
 	},
+	PersistentPostRun: closeCassette,
+	PreRun:            initContext,
 	Run: func(cmd *cobra.Command, args []string) {
 		log := logrus.WithContext(ctx)
+		if errfile != nil {
+			defer errfile.Close()
+		}
 
-		if err := streamer.Stream(ctx, infile, outfile); err != nil {
-			infile.Close()
-			outfile.Close()
-			os.Remove(outfile.Name())
-			log.WithError(err).Error("Could not stream data")
+		if dryRun {
+			sum, err := checkInputs(inputs)
+			logDryRun(log, sum)
+			if err != nil {
+				log.WithError(err).Error("Could not check data")
+			}
 			return
 		}
 
-		infile.Close()
-		outfile.Close()
-		return
+		var (
+			sum *account.Summary
+			err error
+		)
+		if outDir != "" {
+			sum, err = mergeEach(inputs, outDir)
+		} else {
+			sum, err = mergeInto(inputs, output)
+		}
+		logSummary(log, sum)
+		if err != nil {
+			log.WithError(err).Error("Could not stream data")
+		}
 	},
 }
 
+// ruleConfig is a user-defined validation rule from the config file
+type ruleConfig struct {
+	Field   string
+	Pattern string
+	Message string
+}
+
+// columnConfig is a computed column from the config file
+type columnConfig struct {
+	Name string
+	Expr string
+	Type string
+}
+
+// newClient connects to wherever --source says the accounts come from
+func newClient() (account.Client, error) {
+	source := viper.GetString("source")
+	if strings.HasPrefix(source, snapshotSource) {
+		if viper.GetString("record") != "" || viper.GetString("replay") != "" {
+			return nil, errors.New("--record and --replay don't work with a snapshot --source")
+		}
+		snapshot, err := account.OpenSnapshot(strings.TrimPrefix(source, snapshotSource))
+		if err != nil {
+			return nil, err
+		}
+		meta := snapshot.Meta()
+		logrus.WithField("created_at", meta.CreatedAt).WithField("source", meta.Source).Info("Using snapshot")
+		return snapshot, nil
+	}
+
+	addr := url
+	if source != "" {
+		addr = source
+	}
+	clientOps, err := clientOptions()
+	if err != nil {
+		return nil, err
+	}
+	var client account.Client = account.NewWPClient(addr, clientOps...)
+
+	// hedges go inside the breaker, so that it sees one outcome per lookup
+	if viper.GetBool("hedge") {
+		hedgeOps, err := hedgeOptions()
+		if err != nil {
+			return nil, err
+		}
+		client = account.NewHedgingClient(client, hedgeOps...)
+	}
+	if viper.GetBool("circuit-breaker") {
+		breakerOps, err := breakerOptions()
+		if err != nil {
+			return nil, err
+		}
+		client = account.NewBreakerClient(client, breakerOps...)
+	}
+	return client, nil
+}
+
+// clientOptions translates the http settings into options for the client.  They
+// are read through viper so that they can come from the config file too.
+func clientOptions() ([]account.WPClientOption, error) {
+	if fanOut <= 0 {
+		return nil, errors.New("--fan-out must be greater than 0")
+	}
+	ops := []account.WPClientOption{
+		account.WithFanOut(fanOut),
+		account.WithRequestTimeout(viper.GetDuration("request-timeout")),
+		account.WithCallTimeout(viper.GetDuration("call-timeout")),
+		account.WithKeepAlive(viper.GetDuration("keep-alive")),
+		account.WithIdleConnTimeout(viper.GetDuration("idle-conn-timeout")),
+		account.WithUserAgent(viper.GetString("user-agent")),
+	}
+
+	// Size the pool for the most requests we can have in flight, so that
+	// connections get reused
+	maxConns := viper.GetInt("max-conns")
+	if maxConns <= 0 {
+		maxConns = int(maxConcurrentRequests)
+		if adaptiveConcurrency && adaptiveMax > maxConcurrentRequests {
+			maxConns = int(adaptiveMax)
+		}
+		if batchSize > 1 {
+			maxConns *= int(fanOut)
+		}
+	}
+	ops = append(ops, account.WithMaxConns(maxConns))
+
+	if proxy := viper.GetString("proxy"); proxy != "" {
+		proxyURL, err := neturl.Parse(proxy)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid proxy `%s`", proxy)
+		}
+		ops = append(ops, account.WithProxy(proxyURL))
+	}
+
+	tlsOps, err := tlsOptions()
+	if err != nil {
+		return nil, err
+	}
+	ops = append(ops, tlsOps...)
+
+	cassetteOps, err := cassetteOptions()
+	if err != nil {
+		return nil, err
+	}
+	return append(ops, cassetteOps...), nil
+}
+
+// hedgeOptions translates the hedging settings into options
+func hedgeOptions() ([]account.HedgeOption, error) {
+	budget := viper.GetFloat64("hedge-budget")
+	if budget < 0 || budget > 1 {
+		return nil, errors.New("--hedge-budget must be between 0 and 1")
+	}
+	ops := []account.HedgeOption{account.WithHedgeBudget(budget)}
+	if delay := viper.GetDuration("hedge-delay"); delay > 0 {
+		ops = append(ops, account.WithHedgeDelay(delay))
+	}
+	return ops, nil
+}
+
+// breakerOptions translates the circuit breaker settings into options
+func breakerOptions() ([]account.BreakerOption, error) {
+	ratio := viper.GetFloat64("breaker-failure-ratio")
+	if ratio <= 0 || ratio > 1 {
+		return nil, errors.New("--breaker-failure-ratio must be greater than 0 and at most 1")
+	}
+	minRequests := viper.GetInt64("breaker-min-requests")
+	if minRequests <= 0 {
+		return nil, errors.New("--breaker-min-requests must be greater than 0")
+	}
+	return []account.BreakerOption{
+		account.WithFailureRatio(ratio),
+		account.WithMinRequests(minRequests),
+		account.WithCoolDown(viper.GetDuration("breaker-cool-down")),
+	}, nil
+}
+
+// streamerOptions translates the flags and config into options for the
+// streamer
+func streamerOptions() ([]account.WPStreamerOption, error) {
+	ops := []account.WPStreamerOption{
+		account.WithMaxConcurrentRequests(maxConcurrentRequests),
+	}
+	if adaptiveConcurrency {
+		if adaptiveMin <= 0 || adaptiveMax < adaptiveMin {
+			return nil, errors.New("--adaptive-min must be greater than 0 and at most --adaptive-max")
+		}
+		ops = append(ops, account.WithAdaptiveConcurrency(adaptiveMin, adaptiveMax))
+	}
+	if batchSize > 1 {
+		ops = append(ops, account.WithBatchSize(batchSize))
+	}
+	if parallelRead > 1 {
+		// the chunks are validated at the same time, so the row that gets
+		// through wouldn't have to be the first one for its account id
+		if rejectDuplicates {
+			return nil, errors.New("--reject-duplicates can't be used with --parallel-read")
+		}
+		ops = append(ops, account.WithParallelRead(parallelRead))
+	}
+	if flushRows > 0 {
+		ops = append(ops, account.WithFlushEvery(flushRows))
+	}
+	if flushInterval > 0 {
+		ops = append(ops, account.WithFlushInterval(flushInterval))
+	}
+	if maxMemory > 0 {
+		ops = append(ops, account.WithMaxMemory(maxMemory))
+	}
+
+	if dateFormat != "" {
+		loc, err := time.LoadLocation(timezone)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not load timezone `%s`", timezone)
+		}
+		ops = append(ops, account.WithDateFormatter(account.NewDateFormatter(dateFormat, loc)))
+	}
+
+	policy, err := account.ParseDedupePolicy(dedupe)
+	if err != nil {
+		return nil, err
+	}
+	ops = append(ops, account.WithDedupePolicy(policy))
+
+	failurePolicy, err := account.ParseFailurePolicy(onFailure)
+	if err != nil {
+		return nil, err
+	}
+	ops = append(ops, account.WithFailurePolicy(failurePolicy))
+
+	if filter != "" {
+		f, err := account.ParseFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, account.WithFilter(f))
+	}
+	if excludeMissing {
+		ops = append(ops, account.WithExcludeMissing())
+	}
+
+	cols, err := newColumns()
+	if err != nil {
+		return nil, err
+	}
+	ops = append(ops, account.WithColumns(cols...))
+	columnTypes = account.ColumnTypes(cols)
+	if allServerFields {
+		ops = append(ops, account.WithAllServerFields())
+	}
+
+	validator, err := newValidator()
+	if err != nil {
+		return nil, err
+	}
+	ops = append(ops, account.WithValidator(validator))
+
+	if errfile != nil {
+		ops = append(ops, account.WithErrorWriter(errfile))
+	}
+	return ops, nil
+}
+
+// outputStreamer returns a copy of the streamer for a run that has an output of
+// its own.  It gets a new validator, so that --reject-duplicates checks each
+// output on its own, but shares the limit on requests with the other runs.
+func outputStreamer() (*account.WPStreamer, error) {
+	validator, err := newValidator()
+	if err != nil {
+		return nil, err
+	}
+	return streamer.Clone(account.WithValidator(validator)), nil
+}
+
+// newValidator builds the validator from the built-in rules plus any rules
+// listed under `validation.rules` in the config file
+func newValidator() (*account.Validator, error) {
+	rules := account.DefaultRules(maxFieldLength)
+	if rejectDuplicates {
+		rules = append(rules, account.DuplicateRule())
+	}
+
+	var configs []ruleConfig
+	if err := viper.UnmarshalKey("validation.rules", &configs); err != nil {
+		return nil, errors.Wrap(err, "could not read validation rules")
+	}
+	for _, config := range configs {
+		if _, err := account.FieldIndex(config.Field); err != nil {
+			return nil, errors.Wrap(err, "could not read validation rules")
+		}
+		pattern, err := regexp.Compile(config.Pattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not compile pattern for `%s`", config.Field)
+		}
+		rules = append(rules, account.PatternRule(config.Field, pattern, config.Message))
+	}
+	return account.NewValidator(rules...), nil
+}
+
+// newColumns builds the computed columns listed under `columns` in the config
+// file, followed by the ones from the --column and --server-field flags
+func newColumns() ([]*account.Column, error) {
+	var configs []columnConfig
+	if err := viper.UnmarshalKey("columns", &configs); err != nil {
+		return nil, errors.Wrap(err, "could not read columns")
+	}
+
+	var cols []*account.Column
+	for _, config := range configs {
+		col, err := account.ParseColumn(config.Name, config.Expr)
+		if err != nil {
+			return nil, err
+		}
+		if config.Type != "" {
+			if col.Type, err = account.ParseColumnType(config.Type); err != nil {
+				return nil, errors.Wrapf(err, "invalid column `%s`", config.Name)
+			}
+		}
+		cols = append(cols, col)
+	}
+	for _, def := range columns {
+		col, err := account.ParseColumnDefinition(def)
+		if err != nil {
+			return nil, err
+		}
+		cols = append(cols, col)
+	}
+	for _, path := range serverFields {
+		col, err := account.ServerFieldColumn(path)
+		if err != nil {
+			return nil, err
+		}
+		cols = append(cols, col)
+	}
+	return cols, nil
+}
+
+// logSummary reports the counts from a run
+func logSummary(log *logrus.Entry, sum *account.Summary) {
+	log.WithFields(logrus.Fields{
+		"rows":       sum.Rows,
+		"invalid":    sum.Invalid,
+		"duplicates": sum.Duplicates,
+		"failed":     sum.Failed,
+		"filtered":   sum.Filtered,
+		"written":    sum.Written,
+	}).Info("Finished processing rows")
+}
+
+// initContext sets up a context that is cancelled when the user hits Ctrl-C, so
+// that in-flight requests get a chance to wind down
+func initContext(cmd *cobra.Command, args []string) {
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithCancel(context.Background())
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt)
+	go func() {
+		<-sigCh
+		cancel()
+	}()
+}
+
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		if _, ok := err.(*exitError); !ok {
+			fmt.Println(err)
+		}
+		os.Exit(exitCode(err))
 	}
 }
 
+// exitCode is the code the program exits with after the error
+func exitCode(err error) int {
+	if exit, ok := err.(*exitError); ok {
+		return exit.code
+	} else if err != nil {
+		return 1
+	}
+	return 0
+}
+
 func init() {
 	cobra.OnInitialize(initConfig)
 
@@ -112,8 +538,93 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.wpe_merge.yaml)")
 	rootCmd.PersistentFlags().StringVar(&url, "url", "http://interview.wpengine.io/", "URL to connect to the WPE server")
 	rootCmd.PersistentFlags().Int64Var(&maxConcurrentRequests, "max-concurrent-requests", 10, "max concurrent requests to make to the WPE server")
+	rootCmd.PersistentFlags().IntVar(&batchSize, "batch-size", 1, "look up this many rows with each request (uses the bulk endpoint if the server has one)")
+	rootCmd.PersistentFlags().BoolVar(&adaptiveConcurrency, "adaptive-concurrency", false, "adjust the concurrent requests to how the server is coping, starting from --max-concurrent-requests")
+	rootCmd.PersistentFlags().Int64Var(&adaptiveMin, "adaptive-min", 1, "fewest concurrent requests with --adaptive-concurrency")
+	rootCmd.PersistentFlags().Int64Var(&adaptiveMax, "adaptive-max", 100, "most concurrent requests with --adaptive-concurrency")
+	rootCmd.PersistentFlags().Int64Var(&fanOut, "fan-out", 10, "max concurrent requests for a batch when the server has no bulk endpoint")
+	rootCmd.PersistentFlags().Duration("request-timeout", 30*time.Second, "give up on a request that takes longer than this (0 for no limit)")
+	rootCmd.PersistentFlags().Duration("call-timeout", 0, "give up on a lookup, including every request it makes, after this long (0 for no limit)")
+	rootCmd.PersistentFlags().Int("max-conns", 0, "max connections to the server (default matches the max concurrent requests)")
+	rootCmd.PersistentFlags().Duration("keep-alive", 30*time.Second, "how often to probe idle connections to keep them open (negative turns keep-alives off)")
+	rootCmd.PersistentFlags().Duration("idle-conn-timeout", 90*time.Second, "close connections that have been idle for this long")
+	rootCmd.PersistentFlags().String("proxy", "", "http proxy `url` to send requests through (default comes from HTTP_PROXY/HTTPS_PROXY)")
+	rootCmd.PersistentFlags().String("user-agent", account.DefaultUserAgent, "User-Agent header to send with requests")
+	rootCmd.PersistentFlags().Bool("hedge", false, "send a second request for lookups that are slower than usual and take whichever answers first")
+	rootCmd.PersistentFlags().Float64("hedge-budget", 0.1, "most hedges to send, as a share of the lookups")
+	rootCmd.PersistentFlags().Duration("hedge-delay", 0, "hedge after this long (default is the 95th percentile of recent lookups)")
+	rootCmd.PersistentFlags().Bool("circuit-breaker", false, "stop calling the server for a while once too many requests fail")
+	rootCmd.PersistentFlags().Float64("breaker-failure-ratio", 0.5, "share of failed requests that opens the circuit breaker")
+	rootCmd.PersistentFlags().Int64("breaker-min-requests", 20, "requests the circuit breaker waits for before it can open")
+	rootCmd.PersistentFlags().Duration("breaker-cool-down", 30*time.Second, "how long the circuit breaker stays open before trying the server again")
+	rootCmd.PersistentFlags().StringVar(&onFailure, "on-failure", string(account.FailureContinue), "what to do when a lookup fails: continue, abort-on-open (once the circuit breaker opens) or abort")
+	rootCmd.PersistentFlags().String("metrics-addr", "", "serve metrics at http://`addr`/debug/vars while running")
+	rootCmd.PersistentFlags().String("source", "", "where the accounts come from: a server url, or snapshot:<file> for a snapshot (default is --url)")
+	rootCmd.PersistentFlags().String("record", "", "write every request and response to a cassette `file`")
+	rootCmd.PersistentFlags().String("replay", "", "answer requests from a cassette `file` recorded with --record instead of the server")
+	rootCmd.PersistentFlags().String("tls-ca", "", "pem `file` with the certificate authorities to trust instead of the system ones")
+	rootCmd.PersistentFlags().String("tls-cert", "", "pem `file` with a client certificate to present to the server")
+	rootCmd.PersistentFlags().String("tls-key", "", "pem `file` with the key for --tls-cert")
+	rootCmd.PersistentFlags().String("tls-min-version", "", "lowest tls version to accept: 1.0, 1.1, 1.2 or 1.3")
+	rootCmd.PersistentFlags().String("tls-server-name", "", "check the server certificate against this name rather than the host in --url")
+	rootCmd.PersistentFlags().StringSlice("tls-pin", nil, "only trust a server with this public key, as a base64 sha256 hash of the SPKI (can be repeated)")
+	rootCmd.PersistentFlags().IntVar(&parallelRead, "parallel-read", 1, "split each input file into this many chunks and read them at the same time")
+	rootCmd.PersistentFlags().Int64Var(&flushRows, "flush-rows", 0, "flush the output every this many rows (default is when the buffer fills up)")
+	rootCmd.PersistentFlags().DurationVar(&flushInterval, "flush-interval", 0, "flush the output this often, e.g. 1s")
+	rootCmd.PersistentFlags().Int64Var(&maxMemory, "max-memory", 0, "fail the run rather than hold more than this many bytes of account ids and held back rows (0 for no limit)")
+	rootCmd.PersistentFlags().StringVar(&dateFormat, "date-format", "", "output layout for dates: iso, us, rfc3339 or a go time layout (default is to leave dates as they are)")
+	rootCmd.PersistentFlags().StringVar(&timezone, "timezone", "UTC", "time zone to convert dates into when --date-format is set")
+	rootCmd.Flags().StringVar(&outDir, "out-dir", "", "write one output file per input into this directory, instead of a single output file")
+	rootCmd.Flags().IntVar(&parallelFiles, "parallel-files", 4, "with --out-dir, the most input files to merge at the same time")
+	rootCmd.Flags().BoolVar(&sourceColumn, "source-column", false, "add a Source File column with the input each row came from")
+	rootCmd.PersistentFlags().Int64("shard-rows", 0, "split the output into files of at most this many rows, plus a manifest")
+	rootCmd.PersistentFlags().Int64("shard-bytes", 0, "split the output into files of about this many bytes, plus a manifest")
+	rootCmd.PersistentFlags().String("output-format", outputCSV, "format of the output: csv, sqlite or parquet")
+	rootCmd.PersistentFlags().String("sqlite-table", account.DefaultSQLiteTable, "table to write the rows to with --output-format sqlite")
+	rootCmd.PersistentFlags().String("parquet-compression", string(account.ParquetSnappy), "compression for --output-format parquet: snappy, zstd, gzip or none")
+	rootCmd.PersistentFlags().Int64("parquet-row-group-size", account.DefaultRowGroupSize, "bytes of rows in each row group with --output-format parquet")
+	rootCmd.Flags().BoolVar(&dryRun, "dry-run", false, "check the input and estimate the work without calling the server or writing the output")
+	rootCmd.Flags().DurationVar(&requestLatency, "request-latency", 200*time.Millisecond, "how long a request is assumed to take when --dry-run estimates the duration")
+	rootCmd.Flags().StringVar(&errFilename, "error-file", "", "csv file to record rejected and failed rows in")
+	rootCmd.PersistentFlags().IntVar(&maxFieldLength, "max-field-length", 255, "reject rows with a field longer than this (0 for no limit)")
+	rootCmd.PersistentFlags().BoolVar(&rejectDuplicates, "reject-duplicates", false, "reject rows whose account id was already seen in the same output")
+	rootCmd.PersistentFlags().StringVar(&dedupe, "dedupe", string(account.DedupeKeepAll), "what to do with rows that share an account id: keep-all, keep-first, keep-last or merge")
+	rootCmd.PersistentFlags().StringVar(&filter, "filter", "", "only write rows that match the `expression`, e.g. 'status in (\"closed\") && created_on < 2020-01-01'")
+	rootCmd.PersistentFlags().BoolVar(&excludeMissing, "exclude-missing", false, "leave out rows that could not be found on the server")
+	rootCmd.PersistentFlags().StringArrayVar(&columns, "column", nil, "add a computed column as `name=expression`, or `name:type=expression` where type is text, integer, number, boolean or date (can be repeated)")
+	rootCmd.PersistentFlags().StringArrayVar(&serverFields, "server-field", nil, "add a column with the server field at a dot separated json `path`, e.g. plan.name or plan.seats:integer (can be repeated)")
+	rootCmd.PersistentFlags().BoolVar(&allServerFields, "include-all-server-fields", false, "add a column for every other field the server returns")
 	viper.BindPFlag("url", rootCmd.PersistentFlags().Lookup("url"))
 	viper.BindPFlag("max-concurrent-requests", rootCmd.PersistentFlags().Lookup("max-concurrent-requests"))
+	for _, name := range []string{"request-timeout", "call-timeout", "max-conns", "keep-alive", "idle-conn-timeout", "proxy", "user-agent",
+		"tls-ca", "tls-cert", "tls-key", "tls-min-version", "tls-server-name", "tls-pin",
+		"source", "record", "replay", "hedge", "hedge-budget", "hedge-delay",
+		"circuit-breaker", "breaker-failure-ratio", "breaker-min-requests", "breaker-cool-down", "on-failure", "metrics-addr"} {
+		viper.BindPFlag(name, rootCmd.PersistentFlags().Lookup(name))
+	}
+	viper.BindPFlag("adaptive-concurrency", rootCmd.PersistentFlags().Lookup("adaptive-concurrency"))
+	viper.BindPFlag("adaptive-min", rootCmd.PersistentFlags().Lookup("adaptive-min"))
+	viper.BindPFlag("adaptive-max", rootCmd.PersistentFlags().Lookup("adaptive-max"))
+	viper.BindPFlag("batch-size", rootCmd.PersistentFlags().Lookup("batch-size"))
+	viper.BindPFlag("fan-out", rootCmd.PersistentFlags().Lookup("fan-out"))
+	viper.BindPFlag("parallel-read", rootCmd.PersistentFlags().Lookup("parallel-read"))
+	viper.BindPFlag("flush-rows", rootCmd.PersistentFlags().Lookup("flush-rows"))
+	viper.BindPFlag("flush-interval", rootCmd.PersistentFlags().Lookup("flush-interval"))
+	viper.BindPFlag("max-memory", rootCmd.PersistentFlags().Lookup("max-memory"))
+	viper.BindPFlag("date-format", rootCmd.PersistentFlags().Lookup("date-format"))
+	viper.BindPFlag("timezone", rootCmd.PersistentFlags().Lookup("timezone"))
+	viper.BindPFlag("max-field-length", rootCmd.PersistentFlags().Lookup("max-field-length"))
+	viper.BindPFlag("reject-duplicates", rootCmd.PersistentFlags().Lookup("reject-duplicates"))
+	viper.BindPFlag("dedupe", rootCmd.PersistentFlags().Lookup("dedupe"))
+	viper.BindPFlag("filter", rootCmd.PersistentFlags().Lookup("filter"))
+	viper.BindPFlag("exclude-missing", rootCmd.PersistentFlags().Lookup("exclude-missing"))
+	viper.BindPFlag("shard-rows", rootCmd.PersistentFlags().Lookup("shard-rows"))
+	viper.BindPFlag("shard-bytes", rootCmd.PersistentFlags().Lookup("shard-bytes"))
+	viper.BindPFlag("output-format", rootCmd.PersistentFlags().Lookup("output-format"))
+	viper.BindPFlag("sqlite-table", rootCmd.PersistentFlags().Lookup("sqlite-table"))
+	viper.BindPFlag("parquet-compression", rootCmd.PersistentFlags().Lookup("parquet-compression"))
+	viper.BindPFlag("parquet-row-group-size", rootCmd.PersistentFlags().Lookup("parquet-row-group-size"))
+	viper.BindPFlag("include-all-server-fields", rootCmd.PersistentFlags().Lookup("include-all-server-fields"))
 }
 
 // initConfig reads in config file and ENV variables if set.
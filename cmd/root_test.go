@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("root command", func() {
+	BeforeEach(func() {
+		inputs, output, outDir, dryRun, parallelFiles = nil, "", "", false, 4
+	})
+
+	It("should take the last argument as the output", func() {
+		Ω(rootCmd.Args(rootCmd, []string{"a.csv", "b.csv", "out.csv"})).Should(Succeed())
+		Ω(inputs).Should(Equal([]string{"a.csv", "b.csv"}))
+		Ω(output).Should(Equal("out.csv"))
+	})
+
+	It("should require an output", func() {
+		Ω(rootCmd.Args(rootCmd, []string{"a.csv"})).Should(MatchError("required input_file and output_file"))
+	})
+
+	It("should take every argument as an input with --out-dir", func() {
+		outDir = "out"
+		Ω(rootCmd.Args(rootCmd, []string{"a.csv", "b.csv"})).Should(Succeed())
+		Ω(inputs).Should(Equal([]string{"a.csv", "b.csv"}))
+		Ω(output).Should(BeEmpty())
+	})
+
+	It("should take every argument as an input with --dry-run", func() {
+		dryRun = true
+		Ω(rootCmd.Args(rootCmd, []string{"a.csv"})).Should(Succeed())
+		Ω(inputs).Should(Equal([]string{"a.csv"}))
+
+		Ω(rootCmd.Args(rootCmd, []string{"a.csv", "b.csv"})).Should(Succeed())
+		Ω(inputs).Should(Equal([]string{"a.csv", "b.csv"}))
+		Ω(output).Should(BeEmpty())
+	})
+
+	It("should still require an input with --dry-run", func() {
+		dryRun = true
+		Ω(rootCmd.Args(rootCmd, nil)).Should(MatchError("required input_file"))
+	})
+
+	It("should refuse to reject duplicates when reading in parallel", func() {
+		defer func() { parallelRead, rejectDuplicates = 1, false }()
+		parallelRead, rejectDuplicates = 2, true
+		_, err := streamerOptions()
+		Ω(err).Should(MatchError("--reject-duplicates can't be used with --parallel-read"))
+
+		rejectDuplicates = false
+		_, err = streamerOptions()
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	It("should reject a fan out that isn't positive", func() {
+		defer func() { fanOut = 10 }()
+		for _, n := range []int64{0, -1} {
+			fanOut = n
+			_, err := clientOptions()
+			Ω(err).Should(MatchError("--fan-out must be greater than 0"))
+		}
+	})
+})
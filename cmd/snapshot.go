@@ -0,0 +1,154 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/wpe_merge/wpe_merge/account"
+)
+
+const (
+	// snapshotSource is the --source prefix for a snapshot file
+	snapshotSource = "snapshot:"
+	// offlineAnnotation marks the commands that don't need a client
+	offlineAnnotation = "offline"
+)
+
+var (
+	snapshotPageSize   int
+	snapshotDiffOutput string
+)
+
+// snapshotCmd groups the commands that deal with offline copies of the accounts
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Works with offline copies of the accounts on the server",
+	Long: `Works with offline copies of the accounts on the server.
+
+A snapshot can stand in for the server with --source snapshot:<file>, for runs
+that can't reach it or have to give the same answer every time.`,
+}
+
+var snapshotCreateCmd = &cobra.Command{
+	Use:   "create <file>",
+	Short: "Copies every account on the server into a snapshot file",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("required file")
+		}
+		if snapshotPageSize < 0 {
+			return errors.New("--page-size can't be negative")
+		}
+		return nil
+	},
+	PreRun: initContext,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file := args[0]
+		log := logrus.WithContext(ctx).WithField("file", file)
+
+		source := viper.GetString("source")
+		if source == "" {
+			source = url
+		}
+
+		// write next to the file and move it into place at the end, so
+		// that a snapshot that is cut short doesn't replace a good one
+		tmp, err := os.Create(filepath.Join(filepath.Dir(file), "."+filepath.Base(file)+".tmp"))
+		if err != nil {
+			return errors.Wrap(err, "could not create snapshot")
+		}
+		defer os.Remove(tmp.Name())
+
+		n, err := account.WriteSnapshot(ctx, client, tmp, source, snapshotPageSize)
+		if closeErr := tmp.Close(); err == nil && closeErr != nil {
+			err = errors.Wrap(closeErr, "could not write snapshot")
+		}
+		if err != nil {
+			return err
+		}
+		if err := os.Rename(tmp.Name(), file); err != nil {
+			return errors.Wrap(err, "could not create snapshot")
+		}
+
+		log.WithField("accounts", n).Info("Created snapshot")
+		return nil
+	},
+}
+
+var snapshotDiffCmd = &cobra.Command{
+	Use:         "diff <old> <new>",
+	Short:       "Lists the accounts that were added, removed or changed status between two snapshots",
+	Annotations: map[string]string{offlineAnnotation: "true"},
+	Long: `Lists the accounts that were added, removed or changed status between two
+snapshots, with their old and new status and when the new status was set.  The
+report is written to stdout as csv, or as json with the snapshot metadata
+included.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return errors.New("required old and new snapshot files")
+		}
+		switch snapshotDiffOutput {
+		case "csv", "json":
+			return nil
+		}
+		return errors.Errorf("unknown output `%s`, expected csv or json", snapshotDiffOutput)
+	},
+	PreRun: initContext,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		log := logrus.WithContext(ctx)
+
+		old, err := account.OpenSnapshot(args[0])
+		if err != nil {
+			return errors.Wrapf(err, "could not read `%s`", args[0])
+		}
+		new, err := account.OpenSnapshot(args[1])
+		if err != nil {
+			return errors.Wrapf(err, "could not read `%s`", args[1])
+		}
+
+		diff := account.DiffSnapshots(old, new)
+		if snapshotDiffOutput == "json" {
+			err = writeJSON(os.Stdout, diff)
+		} else {
+			err = diff.WriteCSV(os.Stdout)
+		}
+		if err != nil {
+			return errors.Wrap(err, "could not write changes")
+		}
+
+		log.WithFields(logrus.Fields{
+			"added":   diff.Count(account.ChangeAdded),
+			"removed": diff.Count(account.ChangeRemoved),
+			"status":  diff.Count(account.ChangeStatus),
+		}).Info("Compared snapshots")
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(snapshotCmd)
+	snapshotCmd.AddCommand(snapshotCreateCmd)
+	snapshotCmd.AddCommand(snapshotDiffCmd)
+
+	snapshotCreateCmd.Flags().IntVar(&snapshotPageSize, "page-size", 100, "accounts to get with each request (0 leaves it to the server)")
+	snapshotDiffCmd.Flags().StringVarP(&snapshotDiffOutput, "output", "o", "csv", "output format: csv or json")
+}
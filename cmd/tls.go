@@ -0,0 +1,71 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"crypto/tls"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/wpe_merge/wpe_merge/account"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// tlsOptions translates the tls settings into options for the client
+func tlsOptions() ([]account.WPClientOption, error) {
+	var ops []account.WPClientOption
+
+	if file := viper.GetString("tls-ca"); file != "" {
+		pool, err := account.LoadCAFile(file)
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, account.WithRootCAs(pool))
+	}
+
+	certFile, keyFile := viper.GetString("tls-cert"), viper.GetString("tls-key")
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("--tls-cert and --tls-key have to be used together")
+	} else if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not load client certificate")
+		}
+		ops = append(ops, account.WithClientCertificate(cert))
+	}
+
+	if v := viper.GetString("tls-min-version"); v != "" {
+		version, ok := tlsVersions[v]
+		if !ok {
+			return nil, errors.Errorf("unknown tls version `%s`, expected 1.0, 1.1, 1.2 or 1.3", v)
+		}
+		ops = append(ops, account.WithMinTLSVersion(version))
+	}
+
+	if name := viper.GetString("tls-server-name"); name != "" {
+		ops = append(ops, account.WithServerName(name))
+	}
+	if pins := viper.GetStringSlice("tls-pin"); len(pins) > 0 {
+		ops = append(ops, account.WithPinnedKeys(pins...))
+	}
+	return ops, nil
+}
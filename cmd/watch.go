@@ -0,0 +1,268 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/wpe_merge/wpe_merge/account"
+)
+
+const (
+	processedDir = "processed"
+	failedDir    = "failed"
+)
+
+var settle time.Duration
+
+// watchCmd processes files as they are dropped into a folder
+var watchCmd = &cobra.Command{
+	Use:   "watch <in_dir> <out_dir>",
+	Short: "Merges every csv file that lands in a folder",
+	Long: `Watches a folder for csv files and merges each one into a file of the same
+name in the output folder.  A file is picked up once nothing has written to it
+for the --settle period.  Afterwards, the input is moved into the processed/ or
+failed/ folder inside in_dir.  Files that are already in the folder when the
+watch starts are processed too.  Runs until interrupted.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return errors.New("required in_dir and out_dir")
+		}
+		return nil
+	},
+	PreRun: initContext,
+	Run: func(cmd *cobra.Command, args []string) {
+		log := logrus.WithContext(ctx)
+
+		d := newDropFolder(args[0], args[1], settle)
+		if err := d.watch(); err != nil {
+			log.WithError(err).Error("Could not watch folder")
+		}
+	},
+}
+
+// dropFolder feeds the files in a folder through the streamer
+type dropFolder struct {
+	in, out string
+	settle  time.Duration
+
+	// handle is called with each file once it settles
+	handle func(path string)
+
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+	wg     sync.WaitGroup
+}
+
+func newDropFolder(in, out string, settle time.Duration) *dropFolder {
+	d := &dropFolder{
+		in:     in,
+		out:    out,
+		settle: settle,
+		timers: make(map[string]*time.Timer),
+	}
+	d.handle = d.process
+	return d
+}
+
+// watch processes files until the context is cancelled, then waits for the
+// files that are in progress
+func (d *dropFolder) watch() error {
+	log := logrus.WithContext(ctx)
+
+	for _, dir := range []string{d.out, filepath.Join(d.in, processedDir), filepath.Join(d.in, failedDir)} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return errors.Wrapf(err, "could not create directory `%s`", dir)
+		}
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errors.Wrap(err, "could not create watcher")
+	}
+	defer watcher.Close()
+	if err := watcher.Add(d.in); err != nil {
+		return errors.Wrapf(err, "could not watch `%s`", d.in)
+	}
+
+	// pick up anything that landed before we started watching
+	infos, err := ioutil.ReadDir(d.in)
+	if err != nil {
+		return errors.Wrapf(err, "could not read `%s`", d.in)
+	}
+	for _, info := range infos {
+		if info.Mode().IsRegular() {
+			d.schedule(filepath.Join(d.in, info.Name()))
+		}
+	}
+
+	log.WithField("dir", d.in).Info("Watching for files")
+	for {
+		select {
+		case <-ctx.Done():
+			d.stop()
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				d.stop()
+				return nil
+			}
+			if event.Op&(fsnotify.Create|fsnotify.Write) != 0 {
+				d.schedule(event.Name)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				d.stop()
+				return nil
+			}
+			log.WithError(err).Error("Could not watch folder")
+		}
+	}
+}
+
+// schedule processes the file once it has been left alone for the settle
+// period.  Every write to the file starts the wait over again, since we don't
+// get told when the writer closes it.
+//
+// A timer that has already fired can't be reset, or its callback would run a
+// second time, so a write that comes in after that gets a timer of its own.
+func (d *dropFolder) schedule(path string) {
+	name := filepath.Base(path)
+	if strings.HasPrefix(name, ".") || !strings.EqualFold(filepath.Ext(name), ".csv") {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if timer, ok := d.timers[path]; ok && timer.Stop() {
+		timer.Reset(d.settle)
+		return
+	}
+	d.wg.Add(1)
+	var timer *time.Timer
+	timer = time.AfterFunc(d.settle, func() {
+		defer d.wg.Done()
+
+		// a later write may already have replaced this timer
+		d.mu.Lock()
+		if d.timers[path] == timer {
+			delete(d.timers, path)
+		}
+		d.mu.Unlock()
+
+		if ctx.Err() == nil {
+			d.handle(path)
+		}
+	})
+	d.timers[path] = timer
+}
+
+// stop cancels the files that haven't settled yet and waits for the rest
+func (d *dropFolder) stop() {
+	d.mu.Lock()
+	for path, timer := range d.timers {
+		if timer.Stop() {
+			delete(d.timers, path)
+			d.wg.Done()
+		}
+	}
+	d.mu.Unlock()
+	d.wg.Wait()
+}
+
+// process merges the file and moves it out of the way
+func (d *dropFolder) process(path string) {
+	log := logrus.WithContext(ctx).WithField("file", path)
+
+	// the file may have been moved or deleted while it was settling
+	if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+		return
+	}
+
+	sum, err := d.merge(path, filepath.Join(d.out, outputName(path)))
+	logSummary(log, sum)
+
+	// leave the file where it is if we were interrupted, so that it gets
+	// picked up again next time
+	if ctx.Err() != nil {
+		return
+	}
+
+	dir := processedDir
+	if err != nil {
+		log.WithError(err).Error("Could not stream data")
+		dir = failedDir
+	}
+	if err := moveInto(path, filepath.Join(d.in, dir)); err != nil {
+		log.WithError(err).Error("Could not move file")
+	}
+}
+
+// merge streams the input into the output, removing the output if anything
+// goes wrong.  Every file is validated on its own, so an account id from an
+// earlier file isn't a duplicate.
+func (d *dropFolder) merge(input, output string) (*account.Summary, error) {
+	s, err := outputStreamer()
+	if err != nil {
+		return &account.Summary{}, err
+	}
+
+	infile, err := os.Open(input)
+	if err != nil {
+		return &account.Summary{}, errors.Wrapf(err, "could not open file `%s`", input)
+	}
+	defer infile.Close()
+
+	out, err := createOutput(output)
+	if err != nil {
+		return &account.Summary{}, err
+	}
+
+	sum, err := s.RunRecords(ctx, infile, out)
+	if err != nil {
+		out.Remove()
+		return sum, err
+	}
+	return sum, out.Close()
+}
+
+// moveInto moves the file into the directory.  If a file with the same name
+// is already there, the time is added to the name rather than overwriting it.
+func moveInto(path, dir string) error {
+	name := filepath.Base(path)
+	dest := filepath.Join(dir, name)
+	if _, err := os.Stat(dest); err == nil {
+		ext := filepath.Ext(name)
+		dest = filepath.Join(dir, fmt.Sprintf("%s-%s%s", strings.TrimSuffix(name, ext), time.Now().Format("20060102T150405"), ext))
+	}
+	return os.Rename(path, dest)
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+
+	watchCmd.Flags().DurationVar(&settle, "settle", 2*time.Second, "how long a file has to go without being written to before it is processed")
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("dropFolder", func() {
+	const settle = 50 * time.Millisecond
+
+	var (
+		d       *dropFolder
+		mu      sync.Mutex
+		handled []string
+		// release holds up the handler until it is closed
+		release chan struct{}
+	)
+
+	// count returns how many times the file was handled
+	count := func(path string) func() int {
+		return func() int {
+			mu.Lock()
+			defer mu.Unlock()
+			n := 0
+			for _, p := range handled {
+				if p == path {
+					n++
+				}
+			}
+			return n
+		}
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		handled = nil
+		release = make(chan struct{})
+		close(release)
+
+		d = newDropFolder("in", "out", settle)
+		d.handle = func(path string) {
+			mu.Lock()
+			handled = append(handled, path)
+			mu.Unlock()
+			<-release
+		}
+	})
+
+	AfterEach(func() {
+		d.stop()
+	})
+
+	It("should wait for the writes to stop", func() {
+		path := filepath.Join("in", "a.csv")
+		start := time.Now()
+		for i := 0; i < 5; i++ {
+			d.schedule(path)
+			time.Sleep(settle / 5)
+		}
+		Consistently(count(path), settle/2, settle/10).Should(Equal(0))
+
+		Eventually(count(path)).Should(Equal(1))
+		Ω(time.Since(start)).Should(BeNumerically(">=", settle+settle/2))
+		Consistently(count(path), 2*settle).Should(Equal(1))
+	})
+
+	It("should ignore files that aren't csv", func() {
+		d.schedule(filepath.Join("in", "a.txt"))
+		d.schedule(filepath.Join("in", ".a.csv"))
+		d.stop()
+		Ω(handled).Should(BeEmpty())
+	})
+
+	It("should handle a write after the file settled once more", func() {
+		release = make(chan struct{})
+		path := filepath.Join("in", "a.csv")
+		d.schedule(path)
+		Eventually(count(path)).Should(Equal(1))
+
+		// the first timer has fired, so it can't be reset
+		d.schedule(path)
+		close(release)
+		Eventually(count(path)).Should(Equal(2))
+		Consistently(count(path), 2*settle).Should(Equal(2))
+	})
+
+	It("should drop files that haven't settled when stopped", func() {
+		d.schedule(filepath.Join("in", "a.csv"))
+		d.schedule(filepath.Join("in", "b.csv"))
+		d.stop()
+		Consistently(func() []string {
+			mu.Lock()
+			defer mu.Unlock()
+			return handled
+		}, 2*settle).Should(BeEmpty())
+	})
+
+	It("should wait for files in progress when stopped", func() {
+		release = make(chan struct{})
+		path := filepath.Join("in", "a.csv")
+		d.schedule(path)
+		Eventually(count(path)).Should(Equal(1))
+
+		stopped := make(chan struct{})
+		go func() {
+			d.stop()
+			close(stopped)
+		}()
+		Consistently(stopped, settle).ShouldNot(BeClosed())
+		close(release)
+		Eventually(stopped).Should(BeClosed())
+	})
+})